@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,23 +13,19 @@ import (
 const port = 8080
 
 func main() {
-	// four handler examples in the internal/handlers package:
-	// handler (default handler), chunked encoding handler (proxyHandler),
-	// chunked encoding with trailers (proxyHandlerWithTrailers), &
-	// default handler that responds with a video file (BinaryDataHandler)
-
-	// srv, err := server.Serve(handlers.Handler, port)
-	// srv, err := server.Serve(handlers.ProxyHandlerWithTrailers, port)
-	// srv, err := server.Serve(handlers.ProxyHandler, port)
-	srv, err := server.Serve(handlers.BinaryDataHandler, port)
+	// other handlers and middleware to serve here are listed in the README
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	srv, err := server.Serve(handlers.BinaryDataHandler, port,
+		server.WithServerName("goHttp"), server.WithLogger(logger))
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		logger.Error("starting server", "err", err)
+		os.Exit(1)
 	}
 	defer srv.Close()
-	log.Println("Server started on port", port)
+	logger.Info("server started", "port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan // blocking until we get either signal above
-	log.Print("Server gracefully stopped\n\n")
+	logger.Info("server gracefully stopped")
 }
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"goHttp/internal/request"
+	"goHttp/internal/tracing"
+)
+
+// RoundTripper sends a single request and returns the response to it
+type RoundTripper interface {
+	RoundTrip(ctx context.Context, req *request.Request) (*Response, error)
+}
+
+// Client sends requests through a RoundTripper. It does not follow
+// redirects or decode content codings, responses come back as sent.
+type Client struct {
+	// Transport defaults to DefaultTransport when nil
+	Transport RoundTripper
+	// Timeout limits the whole exchange, reading the body included.
+	// Zero means no limit.
+	Timeout time.Duration
+}
+
+var DefaultTransport = &Transport{
+	DialTimeout:     30 * time.Second,
+	MaxIdleConns:    100,
+	IdleConnTimeout: 90 * time.Second,
+}
+
+var DefaultClient = &Client{}
+
+// Do sends req, which needs an absolute-form RequestTarget as made by
+// NewRequest. The caller has to close the body of the returned response.
+// When ctx carries a span, the exchange gets a client span of its own
+// that ends with the body, and req is sent with its trace context. A
+// request id in ctx is sent along in X-Request-ID.
+func (c *Client) Do(ctx context.Context, req *request.Request) (*Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+
+	if id := request.IDFromContext(ctx); id != "" {
+		// replaces an id copied over from an incoming request that was
+		// not accepted
+		req.Headers[strings.ToLower(request.IDHeader)] = id
+	}
+
+	ctx, span := tracing.StartChild(ctx, req.RequestLine.Method, tracing.KindClient)
+	if span != nil {
+		tracing.Inject(req.Headers, span.Context())
+		span.SetAttribute("http.request.method", req.RequestLine.Method)
+		span.SetAttribute("url.full", req.RequestLine.RequestTarget)
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+	resp, err := transport.RoundTrip(ctx, req)
+	if err != nil {
+		cancel()
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", int(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetError(fmt.Errorf("upstream answered %d", resp.StatusCode))
+	}
+	// the timeout keeps running while the body is read
+	resp.Body = &onClose{ReadCloser: resp.Body, fn: func() {
+		cancel()
+		span.End()
+	}}
+	return resp, nil
+}
+
+// Get sends a GET request for rawURL
+func (c *Client) Get(ctx context.Context, rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, req)
+}
+
+// Get sends a GET request for rawURL with DefaultClient
+func Get(ctx context.Context, rawURL string) (*Response, error) {
+	return DefaultClient.Get(ctx, rawURL)
+}
+
+type onClose struct {
+	io.ReadCloser
+	fn func()
+}
+
+func (o *onClose) Close() error {
+	err := o.ReadCloser.Close()
+	o.fn()
+	return err
+}
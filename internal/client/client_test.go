@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+)
+
+func TestWriteRequest(t *testing.T) {
+	req := request.NewRequest()
+	req.RequestLine = request.RequestLine{Method: "POST", RequestTarget: "/things?id=1", HTTPVersion: "1.1"}
+	req.Headers.Set("Host", "example.com")
+	req.Headers.Set("X-Custom", "yes")
+	req.Body = []byte("hello")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRequest(&buf, req))
+
+	// the project's own parser reads back what was written
+	parsed, err := request.RequestFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, req.RequestLine, parsed.RequestLine)
+	assert.Equal(t, "example.com", parsed.Headers["host"])
+	assert.Equal(t, "yes", parsed.Headers["x-custom"])
+	assert.Equal(t, "5", parsed.Headers["content-length"])
+	assert.Equal(t, "hello", string(parsed.Body))
+}
+
+func TestClient(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+
+		switch r.URL.Path {
+		case "/chunked":
+			w.Header().Set("Trailer", "X-Checksum")
+			_, _ = io.WriteString(w, "streamed")
+			w.(http.Flusher).Flush()
+			w.Header().Set("X-Checksum", "abc")
+		default:
+			w.Header().Set("X-Upstream", "yes")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, "created")
+		}
+	}))
+	defer upstream.Close()
+
+	t.Run("request and response", func(t *testing.T) {
+		req, err := NewRequest("POST", upstream.URL+"/things?id=7", []byte("hello"))
+		require.NoError(t, err)
+		req.Headers.Set("X-Custom", "end-to-end")
+
+		resp, err := DefaultClient.Do(context.Background(), req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, "POST", got.Method)
+		assert.Equal(t, "/things", got.URL.Path)
+		assert.Equal(t, "id=7", got.URL.RawQuery)
+		assert.Equal(t, "end-to-end", got.Header.Get("X-Custom"))
+		assert.Equal(t, "hello", gotBody)
+
+		assert.Equal(t, 201, int(resp.StatusCode))
+		assert.Equal(t, "yes", resp.Headers["x-upstream"])
+		assert.Equal(t, "created", string(body))
+	})
+
+	t.Run("chunked response with trailers", func(t *testing.T) {
+		resp, err := Get(context.Background(), upstream.URL+"/chunked")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, "streamed", string(body))
+		assert.Equal(t, "abc", resp.Trailers["x-checksum"])
+	})
+
+	t.Run("bad URLs", func(t *testing.T) {
+		_, err := NewRequest("GET", "ftp://example.com/", nil)
+		assert.ErrorIs(t, err, ErrorUnsupportedScheme)
+		_, err = NewRequest("GET", "/relative", nil)
+		assert.ErrorIs(t, err, ErrorUnsupportedScheme)
+		_, err = NewRequest("GET", "http:///nohost", nil)
+		assert.ErrorIs(t, err, ErrorNoHost)
+	})
+}
+
+func TestClientTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-body" {
+			w.Header().Set("Content-Length", "10")
+			_, _ = io.WriteString(w, "start")
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		_, err := Get(ctx, slow.URL+"/slow-head")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("client timeout covers the body", func(t *testing.T) {
+		c := &Client{Timeout: 50 * time.Millisecond}
+		resp, err := c.Get(context.Background(), slow.URL+"/slow-body")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("response header timeout", func(t *testing.T) {
+		c := &Client{Transport: &Transport{ResponseHeaderTimeout: 20 * time.Millisecond}}
+		_, err := c.Get(context.Background(), slow.URL+"/slow-head")
+		assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "got %v", err)
+	})
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+)
+
+var (
+	ErrorNoHost            = fmt.Errorf("request URL has no host")
+	ErrorUnsupportedScheme = fmt.Errorf("request URL scheme is not http or https")
+)
+
+// NewRequest returns a request for the absolute URL rawURL. The URL stays
+// in RequestTarget in absolute form, which is how the Transport knows
+// where to connect, and the Host header is filled in from it.
+func NewRequest(method, rawURL string, body []byte) (*request.Request, error) {
+	u, err := parseTarget(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req := request.NewRequest()
+	req.RequestLine = request.RequestLine{
+		Method:        method,
+		RequestTarget: u.String(),
+		HTTPVersion:   "1.1",
+	}
+	req.Headers.Set("Host", u.Host)
+	req.Body = body
+	return req, nil
+}
+
+// WriteRequest serializes req to w exactly as it is: the request target is
+// written the way it is stored, so callers pick between origin-form and
+// absolute-form. Content-Length is added when the request carries a body
+// and states no framing of its own.
+func WriteRequest(w io.Writer, req *request.Request) error {
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+	}
+
+	version := req.RequestLine.HTTPVersion
+	if version == "" {
+		version = "1.1"
+	}
+	bw.WriteString(req.RequestLine.Method)
+	bw.WriteString(" ")
+	bw.WriteString(req.RequestLine.RequestTarget)
+	bw.WriteString(" HTTP/")
+	bw.WriteString(version)
+	bw.Write(request.CRLF)
+
+	// Host goes first, as RFC 9112 section 3.2 recommends
+	if host, _ := req.Headers.Get("Host"); host != "" {
+		writeField(bw, "host", host)
+	}
+	for key, val := range req.Headers {
+		if key != "host" {
+			writeField(bw, key, val)
+		}
+	}
+	if needsContentLength(req) {
+		writeField(bw, "content-length", strconv.Itoa(len(req.Body)))
+	}
+	bw.Write(request.CRLF)
+
+	bw.Write(req.Body)
+	return bw.Flush()
+}
+
+func writeField(w *bufio.Writer, key, val string) {
+	w.WriteString(key)
+	w.WriteString(": ")
+	w.WriteString(val)
+	w.Write(request.CRLF)
+}
+
+// needsContentLength reports whether the body length has to be sent. Methods
+// that usually carry a body get one even when it is empty, so the server
+// does not wait for content that never comes.
+func needsContentLength(req *request.Request) bool {
+	if cl, _ := req.Headers.Get("Content-Length"); cl != "" {
+		return false
+	}
+	if te, _ := req.Headers.Get("Transfer-Encoding"); te != "" {
+		return false
+	}
+	if len(req.Body) > 0 {
+		return true
+	}
+	switch req.RequestLine.Method {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
+
+// originForm is the request target as sent to an origin server: the path
+// and query of u, never empty
+func originForm(u *url.URL) string {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return target
+}
+
+func parseTarget(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %s", ErrorUnsupportedScheme, rawURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrorNoHost, rawURL)
+	}
+	return u, nil
+}
+
+// cloneHeaders copies h, so the transport can fill in fields without
+// touching the caller's request
+func cloneHeaders(h headers.Headers) headers.Headers {
+	out := headers.NewHeaders()
+	for key, val := range h {
+		out[key] = val
+	}
+	return out
+}
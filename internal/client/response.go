@@ -0,0 +1,310 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/response"
+)
+
+// maxHeaderBytes caps the status line and header section of a response,
+// so a misbehaving server cannot make us buffer without end
+const maxHeaderBytes = 1 << 20
+
+var (
+	ErrorParseStatusLine = fmt.Errorf("error when parsing the status line")
+	ErrorHeaderTooLarge  = fmt.Errorf("response header section is too large")
+	ErrorMalformedChunk  = fmt.Errorf("malformed chunk in chunked response body")
+)
+
+type Response struct {
+	HTTPVersion string
+	StatusCode  response.StatusCode
+	// Reason is the reason phrase of the status line, possibly empty
+	Reason  string
+	Headers headers.Headers
+	// Body streams the response content with the transfer coding already
+	// removed. It is never nil and has to be closed.
+	Body io.ReadCloser
+	// ContentLength is the length of Body, or -1 when it is only known
+	// once the body has been read
+	ContentLength int64
+	// Trailers holds the trailer fields of a chunked body. They only show
+	// up once Body has been read to the end.
+	Trailers headers.Headers
+
+	// the body runs until the server closes the connection
+	closeDelimited bool
+}
+
+// ResponseFromReader parses one response off reader. method is the method
+// of the request it answers, needed because HEAD responses carry no body
+// whatever their headers say. Interim 1xx responses are skipped, except
+// for 101 Switching Protocols, after which the connection is not HTTP
+// anymore.
+//
+// The body is read lazily from reader, so reader has to stay usable until
+// the body is done. Pass a *bufio.Reader to have it used as is.
+func ResponseFromReader(reader io.Reader, method string) (*Response, error) {
+	br, ok := reader.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(reader)
+	}
+
+	for {
+		resp, err := readHead(br)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != response.StatusSwitchingProtocols {
+			continue
+		}
+
+		if err := resp.setBody(br, method); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// readHead reads the status line and the header section
+func readHead(br *bufio.Reader) (*Response, error) {
+	budget := maxHeaderBytes
+	line, err := readLine(br, &budget)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := parseStatusLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Headers = headers.NewHeaders()
+	if err := readFields(br, resp.Headers, &budget); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func parseStatusLine(line []byte) (*Response, error) {
+	version, rest, ok := bytes.Cut(line, space)
+	if !ok || !bytes.HasPrefix(version, []byte("HTTP/")) {
+		return nil, fmt.Errorf("%w: %q", ErrorParseStatusLine, line)
+	}
+	code, reason, _ := bytes.Cut(rest, space)
+	status, err := strconv.Atoi(string(code))
+	if err != nil || len(code) != 3 || status < 100 {
+		return nil, fmt.Errorf("%w: %q", ErrorParseStatusLine, line)
+	}
+
+	return &Response{
+		HTTPVersion: string(version[len("HTTP/"):]),
+		StatusCode:  response.StatusCode(status),
+		Reason:      string(reason),
+	}, nil
+}
+
+var space = []byte(" ")
+
+// readFields reads header or trailer fields into h up to the empty line
+// that ends them, leaning on headers.Parse for each field line
+func readFields(br *bufio.Reader, h headers.Headers, budget *int) error {
+	for {
+		line, err := readLine(br, budget)
+		if err != nil {
+			return err
+		}
+		// Parse wants the line ending back to know where the field stops
+		if _, done, err := h.Parse(append(line, headers.CRLF...)); err != nil || done {
+			return err
+		}
+	}
+}
+
+// readLine returns the next line without its line ending, charging its
+// length against budget. A bare LF is accepted as a line ending too.
+func readLine(br *bufio.Reader, budget *int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		*budget -= len(chunk)
+		if *budget < 0 {
+			return nil, ErrorHeaderTooLarge
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		return bytes.TrimSuffix(line, []byte("\r")), nil
+	}
+}
+
+// setBody works out how the body is framed (RFC 9112 section 6.3)
+func (r *Response) setBody(br *bufio.Reader, method string) error {
+	if method == "HEAD" || !bodyAllowed(r.StatusCode) {
+		r.ContentLength = 0
+		r.Body = io.NopCloser(bytes.NewReader(nil))
+		return nil
+	}
+
+	te, _ := r.Headers.Get("Transfer-Encoding")
+	if te != "" {
+		codings := strings.Split(te, ",")
+		if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			// without chunked last, the body runs until the connection closes
+			r.ContentLength = -1
+			r.closeDelimited = true
+			r.Body = io.NopCloser(br)
+			return nil
+		}
+		r.ContentLength = -1
+		r.Body = io.NopCloser(&chunkedReader{br: br, resp: r})
+		return nil
+	}
+
+	if cl, _ := r.Headers.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(strings.TrimSpace(cl), 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid Content-Length %q", cl)
+		}
+		r.ContentLength = n
+		r.Body = io.NopCloser(&lengthReader{r: br, remaining: n})
+		return nil
+	}
+
+	r.ContentLength = -1
+	r.closeDelimited = true
+	r.Body = io.NopCloser(br)
+	return nil
+}
+
+func bodyAllowed(status response.StatusCode) bool {
+	return status >= 200 && status != 204 && status != 304
+}
+
+// lengthReader reads exactly remaining bytes, and complains when the
+// connection ends before that
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err == io.EOF && l.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && l.remaining == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunkedReader removes the chunked transfer coding and collects the
+// trailer fields into the response once the last chunk is read
+type chunkedReader struct {
+	br   *bufio.Reader
+	resp *Response
+	// bytes left in the current chunk
+	remaining int64
+	done      bool
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+
+	if c.remaining == 0 {
+		size, err := c.nextChunk()
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+		if size == 0 {
+			c.done = true
+			return 0, c.readTrailers()
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		err = c.chunkEnd()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// nextChunk reads a chunk size line, ignoring any chunk extensions
+func (c *chunkedReader) nextChunk() (int64, error) {
+	budget := maxHeaderBytes
+	line, err := readLine(c.br, &budget)
+	if err != nil {
+		return 0, err
+	}
+	sizeField, _, _ := bytes.Cut(line, []byte(";"))
+	size, err := strconv.ParseInt(string(bytes.TrimSpace(sizeField)), 16, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%w: bad size %q", ErrorMalformedChunk, line)
+	}
+	return size, nil
+}
+
+// chunkEnd consumes the CRLF that follows the data of every chunk
+func (c *chunkedReader) chunkEnd() error {
+	budget := 2
+	line, err := readLine(c.br, &budget)
+	if err != nil {
+		return err
+	}
+	if len(line) != 0 {
+		return fmt.Errorf("%w: missing CRLF after chunk data", ErrorMalformedChunk)
+	}
+	return nil
+}
+
+func (c *chunkedReader) readTrailers() error {
+	trailers := headers.NewHeaders()
+	budget := maxHeaderBytes
+	if err := readFields(c.br, trailers, &budget); err != nil {
+		c.err = err
+		return err
+	}
+	if len(trailers) > 0 {
+		c.resp.Trailers = trailers
+	}
+	return io.EOF
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseFromReader(t *testing.T) {
+	t.Run("content length", func(t *testing.T) {
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"Content-Length: 5\r\n"+
+			"\r\n"+
+			"hello and then some"), "GET")
+		require.NoError(t, err)
+		assert.Equal(t, "1.1", resp.HTTPVersion)
+		assert.Equal(t, 200, int(resp.StatusCode))
+		assert.Equal(t, "OK", resp.Reason)
+		assert.Equal(t, "text/plain", resp.Headers["content-type"])
+		assert.Equal(t, int64(5), resp.ContentLength)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(body))
+	})
+
+	t.Run("chunked with trailers", func(t *testing.T) {
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\n"+
+			"Transfer-Encoding: chunked\r\n"+
+			"Trailer: X-Checksum\r\n"+
+			"\r\n"+
+			"5;ext=1\r\nhello\r\n"+
+			"7\r\n, world\r\n"+
+			"0\r\n"+
+			"X-Checksum: abc\r\n"+
+			"\r\n"), "GET")
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.Nil(t, resp.Trailers)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello, world", string(body))
+		assert.Equal(t, "abc", resp.Trailers["x-checksum"])
+	})
+
+	t.Run("close delimited", func(t *testing.T) {
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\n\r\nuntil the end"), "GET")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "until the end", string(body))
+	})
+
+	t.Run("no body", func(t *testing.T) {
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n"), "HEAD")
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Empty(t, body)
+
+		resp, err = ResponseFromReader(strings.NewReader("HTTP/1.1 304 Not Modified\r\nETag: \"x\"\r\n\r\n"), "GET")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), resp.ContentLength)
+	})
+
+	t.Run("interim responses are skipped", func(t *testing.T) {
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 100 Continue\r\n\r\n"+
+			"HTTP/1.1 204\r\n\r\n"), "POST")
+		require.NoError(t, err)
+		assert.Equal(t, 204, int(resp.StatusCode))
+		assert.Empty(t, resp.Reason)
+	})
+
+	t.Run("truncated bodies", func(t *testing.T) {
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort"), "GET")
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+		resp, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel"), "GET")
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := ResponseFromReader(strings.NewReader("HTTP/1.1 OK\r\n\r\n"), "GET")
+		assert.ErrorIs(t, err, ErrorParseStatusLine)
+
+		_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nBad Header\r\n\r\n"), "GET")
+		assert.Error(t, err)
+
+		resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n"), "GET")
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, ErrorMalformedChunk)
+	})
+}
@@ -0,0 +1,474 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost is used when Transport.MaxIdleConnsPerHost is zero
+	DefaultMaxIdleConnsPerHost = 2
+
+	// a body closed before its end is read out up to this many bytes to
+	// save the connection, anything longer is cheaper to redial
+	maxDrain = 256 << 10
+)
+
+// Transport sends requests over HTTP/1.1 connections, over TLS for https
+// URLs. Connections are kept alive and reused per host once the response
+// body is done. The zero Transport is ready to use.
+type Transport struct {
+	// DialTimeout limits how long connecting may take, TLS handshake included
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout limits the wait for the response head once
+	// the request is written. Zero means no limit.
+	ResponseHeaderTimeout time.Duration
+	// TLSConfig is used for https, a nil one gets the defaults
+	TLSConfig *tls.Config
+	// Control is handed to the net.Dialer. It sees the resolved address
+	// before connecting and can refuse it by returning an error.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// DisableKeepAlives uses a fresh connection for every request
+	DisableKeepAlives bool
+	// MaxIdleConns caps the idle connections over all hosts.
+	// Zero means no limit.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections kept for each host,
+	// DefaultMaxIdleConnsPerHost when zero
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the connections to each host, dialing, in use
+	// and idle alike. Requests over the limit wait for a connection to
+	// free up. Zero means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long a connection may sit idle before it is
+	// closed. Zero means it stays until the server closes it.
+	IdleConnTimeout time.Duration
+
+	mu        sync.Mutex
+	idle      map[string][]*persistConn
+	idleCount int
+	// per host semaphores for MaxConnsPerHost, and how many wait on them
+	slots   map[string]chan struct{}
+	waiting map[string]int
+}
+
+// persistConn is a connection that may carry several requests in turn
+type persistConn struct {
+	t      *Transport
+	key    string
+	conn   net.Conn
+	br     *bufio.Reader
+	reused bool
+	// closes the connection once it sat idle for too long
+	idleTimer *time.Timer
+	closeOnce sync.Once
+}
+
+// RoundTrip implements RoundTripper. Cancelling ctx aborts the exchange,
+// including any read of the response body still going on.
+//
+// A request that fails on a reused connection before any of the response
+// arrived most likely raced the server closing it. Idempotent requests are
+// sent again on another connection then.
+func (t *Transport) RoundTrip(ctx context.Context, req *request.Request) (*Response, error) {
+	u, err := parseTarget(req.RequestLine.RequestTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *req
+	out.RequestLine.RequestTarget = originForm(u)
+	out.Headers = cloneHeaders(req.Headers)
+	if host, _ := out.Headers.Get("Host"); host == "" {
+		out.Headers.Set("Host", u.Host)
+	}
+	if t.DisableKeepAlives {
+		out.Headers["connection"] = "close"
+	}
+
+	for {
+		pc, err := t.getConn(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		resp, retry, err := t.exchange(ctx, pc, &out)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !retry || !pc.reused || !idempotent(req.RequestLine.Method) {
+			return nil, err
+		}
+	}
+}
+
+// exchange writes req on pc and reads the response head. retry reports
+// whether the server never saw or never answered the request.
+func (t *Transport) exchange(ctx context.Context, pc *persistConn, req *request.Request) (resp *Response, retry bool, err error) {
+	stop := watchContext(ctx, pc.conn)
+	defer func() {
+		if err != nil {
+			stop()
+			pc.close()
+		}
+	}()
+
+	bw := bufio.NewWriter(pc.conn)
+	if err := WriteRequest(bw, req); err != nil {
+		return nil, true, err
+	}
+
+	if t.ResponseHeaderTimeout > 0 {
+		pc.conn.SetReadDeadline(time.Now().Add(t.ResponseHeaderTimeout))
+	}
+	// a connection the server closed fails right here, without a byte
+	if _, err := pc.br.Peek(1); err != nil {
+		return nil, true, err
+	}
+	resp, err = ResponseFromReader(pc.br, req.RequestLine.Method)
+	if err != nil {
+		return nil, false, err
+	}
+	if t.ResponseHeaderTimeout > 0 {
+		pc.conn.SetReadDeadline(time.Time{})
+	}
+
+	resp.Body = &connBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		pc:         pc,
+		stop:       stop,
+		keepAlive:  !t.DisableKeepAlives && keepAlive(req, resp),
+	}
+	return resp, false, nil
+}
+
+// getConn hands out an idle connection to the host of u, or dials a new one
+func (t *Transport) getConn(ctx context.Context, u *url.URL) (*persistConn, error) {
+	key := u.Scheme + "://" + hostPort(u)
+	for {
+		pc := t.takeIdle(key)
+		if pc == nil {
+			break
+		}
+		if pc.alive() {
+			pc.reused = true
+			return pc, nil
+		}
+		pc.close()
+	}
+
+	if err := t.acquire(ctx, key); err != nil {
+		return nil, err
+	}
+	conn, err := t.dial(ctx, u)
+	if err != nil {
+		t.release(key)
+		return nil, err
+	}
+	return &persistConn{t: t, key: key, conn: conn, br: bufio.NewReader(conn)}, nil
+}
+
+// CloseIdleConnections closes every connection not carrying a request
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	var idle []*persistConn
+	for _, conns := range t.idle {
+		idle = append(idle, conns...)
+	}
+	t.idle = nil
+	t.idleCount = 0
+	t.mu.Unlock()
+
+	for _, pc := range idle {
+		pc.close()
+	}
+}
+
+// takeIdle pops the most recently used idle connection for key
+func (t *Transport) takeIdle(key string) *persistConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conns := t.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	pc := conns[len(conns)-1]
+	t.idle[key] = conns[:len(conns)-1]
+	t.idleCount--
+	if pc.idleTimer != nil {
+		pc.idleTimer.Stop()
+	}
+	return pc
+}
+
+// putIdle keeps pc around for the next request to its host, unless
+// that would go over the limits
+func (t *Transport) putIdle(pc *persistConn) {
+	t.mu.Lock()
+	maxPerHost := t.MaxIdleConnsPerHost
+	if maxPerHost == 0 {
+		maxPerHost = DefaultMaxIdleConnsPerHost
+	}
+	// requests waiting on MaxConnsPerHost get the slot instead
+	full := t.waiting[pc.key] > 0 ||
+		len(t.idle[pc.key]) >= maxPerHost ||
+		(t.MaxIdleConns > 0 && t.idleCount >= t.MaxIdleConns)
+	if full {
+		t.mu.Unlock()
+		pc.close()
+		return
+	}
+
+	if t.idle == nil {
+		t.idle = map[string][]*persistConn{}
+	}
+	t.idle[pc.key] = append(t.idle[pc.key], pc)
+	t.idleCount++
+	if t.IdleConnTimeout > 0 {
+		pc.idleTimer = time.AfterFunc(t.IdleConnTimeout, func() {
+			if t.removeIdle(pc) {
+				pc.close()
+			}
+		})
+	}
+	t.mu.Unlock()
+}
+
+func (t *Transport) removeIdle(pc *persistConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conns := t.idle[pc.key]
+	i := slices.Index(conns, pc)
+	if i == -1 {
+		return false
+	}
+	t.idle[pc.key] = slices.Delete(conns, i, i+1)
+	t.idleCount--
+	return true
+}
+
+// acquire takes one of the MaxConnsPerHost slots for key, waiting for one
+// to free up if need be
+func (t *Transport) acquire(ctx context.Context, key string) error {
+	if t.MaxConnsPerHost <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	if t.slots == nil {
+		t.slots = map[string]chan struct{}{}
+		t.waiting = map[string]int{}
+	}
+	slots, ok := t.slots[key]
+	if !ok {
+		slots = make(chan struct{}, t.MaxConnsPerHost)
+		t.slots[key] = slots
+	}
+	t.waiting[key]++
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.waiting[key]--
+		t.mu.Unlock()
+	}()
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Transport) release(key string) {
+	if t.MaxConnsPerHost <= 0 {
+		return
+	}
+	t.mu.Lock()
+	slots := t.slots[key]
+	t.mu.Unlock()
+	<-slots
+}
+
+func (t *Transport) dial(ctx context.Context, u *url.URL) (net.Conn, error) {
+	if t.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.DialTimeout)
+		defer cancel()
+	}
+
+	addr := hostPort(u)
+	dialer := &net.Dialer{Control: t.Control}
+	if u.Scheme != "https" {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	config := &tls.Config{}
+	if t.TLSConfig != nil {
+		config = t.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: config}
+	return tlsDialer.DialContext(ctx, "tcp", addr)
+}
+
+// alive checks an idle connection before it is reused. The server may
+// have closed it in the meantime, or sent something nobody asked for,
+// and either way it is no good anymore.
+func (pc *persistConn) alive() bool {
+	if pc.br.Buffered() > 0 {
+		return false
+	}
+	pc.conn.SetReadDeadline(time.Now())
+	_, err := pc.br.Peek(1)
+	pc.conn.SetReadDeadline(time.Time{})
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (pc *persistConn) close() {
+	pc.closeOnce.Do(func() {
+		pc.conn.Close()
+		pc.t.release(pc.key)
+	})
+}
+
+// keepAlive reports whether the connection can carry another request
+// once resp is read (RFC 9112 section 9.3)
+func keepAlive(req *request.Request, resp *Response) bool {
+	if hasToken(req.Headers["connection"], "close") || hasToken(resp.Headers["connection"], "close") {
+		return false
+	}
+	if resp.closeDelimited || resp.StatusCode == response.StatusSwitchingProtocols {
+		return false
+	}
+	if resp.HTTPVersion == "1.0" {
+		return hasToken(resp.Headers["connection"], "keep-alive")
+	}
+	return true
+}
+
+func hasToken(list, token string) bool {
+	for _, field := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(field), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotent methods can safely be sent twice (RFC 9110 section 9.2.2)
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// hostPort is the address to dial for u, with the default port of its
+// scheme when it names none
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// watchContext unblocks reads and writes on conn once ctx is done, by
+// moving its deadline into the past. The returned func stops the watch
+// and only returns once the watcher is gone.
+func watchContext(ctx context.Context, conn net.Conn) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+// connBody hands the connection back to the pool once the body is read
+// and closed, and reports a cancelled context instead of the deadline
+// error it caused
+type connBody struct {
+	io.ReadCloser
+	ctx       context.Context
+	pc        *persistConn
+	stop      func()
+	keepAlive bool
+
+	eof      bool
+	closed   bool
+	closeMux sync.Mutex
+}
+
+func (b *connBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) {
+		b.eof = true
+	} else if err != nil && b.ctx.Err() != nil {
+		err = b.ctx.Err()
+	}
+	return n, err
+}
+
+func (b *connBody) Close() error {
+	b.closeMux.Lock()
+	defer b.closeMux.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	reuse := b.keepAlive && b.ctx.Err() == nil
+	if reuse && !b.eof {
+		// the rest of the body is still on the wire and has to go first
+		n, err := io.CopyN(io.Discard, b.ReadCloser, maxDrain+1)
+		reuse = errors.Is(err, io.EOF) && n <= maxDrain
+	}
+	b.stop()
+	if reuse && b.ctx.Err() == nil {
+		b.pc.t.putIdle(b.pc)
+		return nil
+	}
+	b.pc.close()
+	return nil
+}
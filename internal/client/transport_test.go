@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingServer is an httptest server that counts the connections made to it
+func countingServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *atomic.Int64) {
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func get(t *testing.T, c *Client, url string) string {
+	t.Helper()
+	resp, err := c.Get(context.Background(), url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func (t *Transport) idleConns() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.idleCount
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			_, _ = io.WriteString(w, "part one, ")
+			w.(http.Flusher).Flush()
+		}
+		_, _ = io.WriteString(w, "hello")
+	})
+	transport := &Transport{}
+	c := &Client{Transport: transport}
+
+	t.Run("sequential requests share a connection", func(t *testing.T) {
+		assert.Equal(t, "hello", get(t, c, srv.URL))
+		assert.Equal(t, "part one, hello", get(t, c, srv.URL+"/chunked"))
+		assert.Equal(t, "hello", get(t, c, srv.URL))
+		assert.Equal(t, int64(1), conns.Load())
+		assert.Equal(t, 1, transport.idleConns())
+	})
+
+	t.Run("unread bodies are drained", func(t *testing.T) {
+		resp, err := c.Get(context.Background(), srv.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "hello", get(t, c, srv.URL))
+		assert.Equal(t, int64(1), conns.Load())
+	})
+
+	t.Run("server closed idle connections are not reused", func(t *testing.T) {
+		srv.CloseClientConnections()
+		assert.Equal(t, "hello", get(t, c, srv.URL))
+		assert.Equal(t, int64(2), conns.Load())
+	})
+
+	t.Run("keep-alives can be turned off", func(t *testing.T) {
+		c := &Client{Transport: &Transport{DisableKeepAlives: true}}
+		before := conns.Load()
+		get(t, c, srv.URL)
+		get(t, c, srv.URL)
+		assert.Equal(t, before+2, conns.Load())
+	})
+}
+
+func TestTransportIdleLimits(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})
+
+	t.Run("per host", func(t *testing.T) {
+		transport := &Transport{MaxIdleConnsPerHost: 2}
+		c := &Client{Transport: transport}
+
+		// three requests in flight at once need three connections,
+		// only two of them are kept afterwards
+		var bodies []io.Closer
+		for range 3 {
+			resp, err := c.Get(context.Background(), srv.URL)
+			require.NoError(t, err)
+			bodies = append(bodies, resp.Body)
+		}
+		for _, body := range bodies {
+			body.Close()
+		}
+		assert.Equal(t, 2, transport.idleConns())
+
+		transport.CloseIdleConnections()
+		assert.Equal(t, 0, transport.idleConns())
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		transport := &Transport{IdleConnTimeout: 20 * time.Millisecond}
+		get(t, &Client{Transport: transport}, srv.URL)
+		assert.Equal(t, 1, transport.idleConns())
+		assert.Eventually(t, func() bool { return transport.idleConns() == 0 }, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("connections per host", func(t *testing.T) {
+		transport := &Transport{MaxConnsPerHost: 1}
+		c := &Client{Transport: transport}
+
+		held, err := c.Get(context.Background(), srv.URL)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		_, err = c.Get(ctx, srv.URL)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// a waiting request gets the connection as soon as it is free
+		time.AfterFunc(20*time.Millisecond, func() { held.Body.Close() })
+		assert.Equal(t, "hello", get(t, c, srv.URL))
+	})
+}
+
+// staleServer answers the first request on every connection with
+// keep-alive, and then hangs up on the second one without answering,
+// as if its idle timeout ran out just as the request came in
+func staleServer(t *testing.T) (string, *atomic.Int64) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	var conns atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				if !readRequestHead(br) {
+					return
+				}
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+				// wait for the next request to show up, then drop it
+				_, _ = br.Peek(1)
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String(), &conns
+}
+
+// readRequestHead reads a request head without a body off br
+func readRequestHead(br *bufio.Reader) bool {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		if strings.TrimSpace(line) == "" {
+			return true
+		}
+	}
+}
+
+func TestTransportRetriesStaleConnections(t *testing.T) {
+	url, conns := staleServer(t)
+	c := &Client{Transport: &Transport{}}
+
+	assert.Equal(t, "ok", get(t, c, url))
+
+	// the idle connection still looks fine, the server drops it only once
+	// the request is in, and GET is safe to send again
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, int64(2), conns.Load())
+
+	// POST is not, the error makes it back to the caller
+	req, err := NewRequest("POST", url, []byte("once"))
+	require.NoError(t, err)
+	_, err = c.Do(context.Background(), req)
+	assert.Error(t, err)
+}
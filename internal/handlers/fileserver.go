@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// sniffLen is how many bytes http.DetectContentType looks at
+const sniffLen = 512
+
+type FileServerOptions struct {
+	// StripPrefix is cut off the request path before looking up the file,
+	// so a FileServer can be mounted somewhere like "/static/"
+	StripPrefix string
+	// ListDirectories renders an HTML listing for directories that have no
+	// index.html. Without it those directories are a 404.
+	ListDirectories bool
+	// StrongETags hashes every file served to get a strong ETag, which
+	// If-Range needs. Without it ETags are weak ones from size and mod time.
+	StrongETags bool
+}
+
+var dirListTemplate = template.Must(template.New("dir").Parse(`<html>
+  <head>
+    <title>Index of {{.Path}}</title>
+  </head>
+  <body>
+    <h1>Index of {{.Path}}</h1>
+    <ul>
+    {{- range .Entries}}
+      <li><a href="{{.Href}}">{{.Name}}</a></li>
+    {{- end}}
+    </ul>
+  </body>
+</html>`))
+
+type dirEntry struct {
+	Name string
+	Href string
+}
+
+// FileServer returns a handler that serves the files in fsys, streaming them
+// instead of reading them into memory. Use os.DirFS to serve a directory.
+func FileServer(fsys fs.FS, opts FileServerOptions) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			_ = w.WriteError(server.NewHandlerError(response.StatusMethodNotAllowed, "").
+				WithHeader("Allow", "GET, HEAD"))
+			return
+		}
+
+		urlPath := req.Path()
+		if !strings.HasPrefix(urlPath, opts.StripPrefix) {
+			_ = w.WriteError(server.NewHandlerError(response.StatusNotFound, ""))
+			return
+		}
+		urlPath = "/" + strings.TrimPrefix(strings.TrimPrefix(urlPath, opts.StripPrefix), "/")
+
+		// refuse ".." outright rather than cleaning it away,
+		// nobody asks for one of those with good intentions
+		for _, segment := range strings.Split(urlPath, "/") {
+			if segment == ".." {
+				_ = w.WriteError(server.NewHandlerError(response.StatusBad, "invalid path"))
+				return
+			}
+		}
+		name := strings.TrimPrefix(path.Clean(urlPath), "/")
+		if name == "" {
+			name = "."
+		}
+		if !fs.ValidPath(name) {
+			_ = w.WriteError(server.NewHandlerError(response.StatusBad, "invalid path"))
+			return
+		}
+
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			_ = w.WriteError(fsError(err))
+			return
+		}
+
+		if info.IsDir() {
+			// relative links in the index or listing only work with the trailing slash
+			if !strings.HasSuffix(req.Path(), "/") {
+				redirect(w, (&url.URL{Path: req.Path() + "/"}).EscapedPath())
+				return
+			}
+
+			index := path.Join(name, "index.html")
+			if indexInfo, err := fs.Stat(fsys, index); err == nil && !indexInfo.IsDir() {
+				serveFile(w, req, fsys, index, opts.StrongETags)
+				return
+			}
+			if !opts.ListDirectories {
+				_ = w.WriteError(server.NewHandlerError(response.StatusNotFound, ""))
+				return
+			}
+			listDirectory(w, fsys, name, urlPath)
+			return
+		}
+
+		serveFile(w, req, fsys, name, opts.StrongETags)
+	}
+}
+
+// serveFile streams a single file along with its Content-Type,
+// Content-Length and validator headers, or just the parts of it asked
+// for in a Range header. Conditional requests are answered with a 304
+// or 412 where they apply.
+func serveFile(w *response.Writer, req *request.Request, fsys fs.FS, name string, strongETag bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		_ = w.WriteError(fsError(err))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = w.WriteError(fsError(err))
+		return
+	}
+
+	var body io.Reader = f
+	content, seekable := f.(io.ReadSeeker)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		// nothing to go on from the name, so look at the first bytes instead
+		sniff := make([]byte, sniffLen)
+		n, err := io.ReadFull(f, sniff)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			_ = w.WriteError(err)
+			return
+		}
+		contentType = http.DetectContentType(sniff[:n])
+
+		// then rewind, or put them back in front of the rest of the file
+		// when the file can not seek
+		if seekable {
+			if _, err := content.Seek(0, io.SeekStart); err != nil {
+				_ = w.WriteError(err)
+				return
+			}
+		} else {
+			body = io.MultiReader(bytes.NewReader(sniff[:n]), f)
+		}
+	}
+
+	heads := response.GetDefaultHeaders(int(info.Size()))
+	_ = heads.Update("Content-Type", contentType)
+	modTime := info.ModTime()
+	if !modTime.IsZero() {
+		heads.Set("Last-Modified", response.FormatDate(modTime))
+	}
+
+	etag := response.WeakETag(info.Size(), modTime)
+	if strongETag && seekable {
+		if etag, err = hashETag(content); err != nil {
+			_ = w.WriteError(err)
+			return
+		}
+	}
+	heads.Set("ETag", etag)
+
+	switch req.EvaluatePreconditions(etag, modTime) {
+	case request.PreconditionNotModified:
+		_ = w.WriteNotModified(heads)
+		return
+	case request.PreconditionFailed:
+		_ = w.WriteError(server.NewHandlerError(response.StatusPreconditionFailed, ""))
+		return
+	}
+
+	// ranges need to jump around in the file
+	if seekable {
+		heads.Set("Accept-Ranges", "bytes")
+		if rangeHeader, _ := req.Headers.Get("Range"); rangeHeader != "" && ifRangeMatches(req, etag, modTime) {
+			if serveRanges(w, req, content, info.Size(), heads) {
+				return
+			}
+		}
+	}
+
+	if err := w.WriteStatusLine(response.StatusOK); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return
+	}
+	_, _ = w.WriteBodyFrom(body)
+}
+
+// hashETag reads content through once to get its strong ETag,
+// then rewinds it for serving
+func hashETag(content io.ReadSeeker) (string, error) {
+	etag, err := response.StrongETagFrom(content)
+	if err != nil {
+		return "", err
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	return etag, err
+}
+
+func listDirectory(w *response.Writer, fsys fs.FS, name, urlPath string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		_ = w.WriteError(fsError(err))
+		return
+	}
+
+	data := struct {
+		Path    string
+		Entries []dirEntry
+	}{Path: urlPath}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		// "./" keeps a name like "a:b" from being read as a URL scheme
+		href := "./" + (&url.URL{Path: entryName}).EscapedPath()
+		data.Entries = append(data.Entries, dirEntry{Name: entryName, Href: href})
+	}
+
+	var body bytes.Buffer
+	if err := dirListTemplate.Execute(&body, data); err != nil {
+		_ = w.WriteError(err)
+		return
+	}
+
+	heads := response.GetDefaultHeaders(body.Len())
+	_ = heads.Update("Content-Type", "text/html; charset=utf-8")
+	server.WriteResponse(w, response.StatusOK, heads, body.String())
+}
+
+func redirect(w *response.Writer, location string) {
+	heads := response.GetDefaultHeaders(0)
+	heads.Set("Location", location)
+	server.WriteResponse(w, response.StatusMovedPermanently, heads, "")
+}
+
+// fsError maps errors from the file system onto the status to answer with
+func fsError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return server.NewHandlerError(response.StatusNotFound, "")
+	case errors.Is(err, fs.ErrPermission):
+		return server.NewHandlerError(response.StatusForbidden, "")
+	default:
+		return err
+	}
+}
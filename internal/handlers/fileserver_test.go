@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+)
+
+// serve runs h the way the server would and parses what it wrote back
+func serve(t *testing.T, h server.Handler, raw string) *http.Response {
+	t.Helper()
+	return servetest.Serve(t, h, raw, func(w *response.Writer, req *request.Request) {
+		w.SetErrorHandler(func(err error) {
+			herr := server.NewHandlerError(response.ErrorStatus(err), "")
+			errors.As(err, &herr)
+			server.ProblemJSONRenderer(w, req, herr)
+		})
+	})
+}
+
+var modTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+var testFS = fstest.MapFS{
+	"index.html":       {Data: []byte("<h1>home</h1>"), ModTime: modTime},
+	"css/site.css":     {Data: []byte("body {}"), ModTime: modTime},
+	"docs/a b.txt":     {Data: []byte("spaced out"), ModTime: modTime},
+	"docs/notes/x.md":  {Data: []byte("# x"), ModTime: modTime},
+	"blob":             {Data: []byte("%PDF-1.7 not really"), ModTime: modTime},
+	"digits.txt":       {Data: []byte("0123456789"), ModTime: modTime},
+	"empty/index.html": {Data: []byte("empty index"), ModTime: modTime},
+}
+
+func TestFileServer(t *testing.T) {
+	h := FileServer(testFS, FileServerOptions{ListDirectories: true})
+
+	t.Run("file with known extension", func(t *testing.T) {
+		resp := serve(t, h, "GET /css/site.css HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "body {}", string(body))
+		assert.Equal(t, "text/css; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "7", resp.Header.Get("Content-Length"))
+		assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", resp.Header.Get("Last-Modified"))
+	})
+
+	t.Run("content type sniffed without extension", func(t *testing.T) {
+		resp := serve(t, h, "GET /blob HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, "application/pdf", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "%PDF-1.7 not really", string(body))
+	})
+
+	t.Run("index.html for directories", func(t *testing.T) {
+		resp := serve(t, h, "GET / HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "<h1>home</h1>", string(body))
+	})
+
+	t.Run("directory without slash redirects", func(t *testing.T) {
+		resp := serve(t, h, "GET /docs HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 301, resp.StatusCode)
+		assert.Equal(t, "/docs/", resp.Header.Get("Location"))
+	})
+
+	t.Run("directory listing", func(t *testing.T) {
+		resp := serve(t, h, "GET /docs/ HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, string(body), `<a href="./a%20b.txt">a b.txt</a>`)
+		assert.Contains(t, string(body), `<a href="./notes/">notes/</a>`)
+	})
+
+	t.Run("listing disabled", func(t *testing.T) {
+		h := FileServer(testFS, FileServerOptions{})
+		resp := serve(t, h, "GET /docs/ HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("path traversal is rejected", func(t *testing.T) {
+		for _, target := range []string{"/../etc/passwd", "/docs/../../etc/passwd", "/%2e%2e/etc/passwd"} {
+			resp := serve(t, h, "GET "+target+" HTTP/1.1\r\n\r\n")
+			assert.Equal(t, 400, resp.StatusCode, target)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		resp := serve(t, h, "GET /nope.txt HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("strip prefix", func(t *testing.T) {
+		h := FileServer(testFS, FileServerOptions{StripPrefix: "/static"})
+		resp := serve(t, h, "GET /static/css/site.css HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("HEAD keeps headers only", func(t *testing.T) {
+		resp := serve(t, h, "HEAD /css/site.css HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "7", resp.Header.Get("Content-Length"))
+		assert.Empty(t, body)
+	})
+
+	t.Run("only GET and HEAD", func(t *testing.T) {
+		resp := serve(t, h, "POST /css/site.css HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 405, resp.StatusCode)
+		assert.Equal(t, "GET, HEAD", resp.Header.Get("Allow"))
+	})
+}
+
+func TestFileServerConditional(t *testing.T) {
+	h := FileServer(testFS, FileServerOptions{})
+
+	resp := serve(t, h, "GET /css/site.css HTTP/1.1\r\n\r\n")
+	etag := resp.Header.Get("ETag")
+	require.True(t, strings.HasPrefix(etag, `W/"`), etag)
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		resp := serve(t, h, "GET /css/site.css HTTP/1.1\r\nIf-None-Match: "+etag+"\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 304, resp.StatusCode)
+		assert.Equal(t, etag, resp.Header.Get("ETag"))
+		assert.Empty(t, resp.Header.Get("Content-Type"))
+		assert.Empty(t, body)
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		resp := serve(t, h, "GET /css/site.css HTTP/1.1\r\nIf-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n\r\n")
+		assert.Equal(t, 304, resp.StatusCode)
+	})
+
+	t.Run("If-Match", func(t *testing.T) {
+		resp := serve(t, h, "GET /css/site.css HTTP/1.1\r\nIf-Match: \"something-else\"\r\n\r\n")
+		assert.Equal(t, 412, resp.StatusCode)
+	})
+
+	t.Run("strong ETags work with If-Range", func(t *testing.T) {
+		h := FileServer(testFS, FileServerOptions{StrongETags: true})
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\n\r\n")
+		etag := resp.Header.Get("ETag")
+		require.True(t, strings.HasPrefix(etag, `"`), etag)
+
+		resp = serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=0-0\r\nIf-Range: "+etag+"\r\n\r\n")
+		assert.Equal(t, 206, resp.StatusCode)
+	})
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"goHttp/internal/client"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// viaPseudonym names this proxy in the Via header of forwarded requests
+const viaPseudonym = "goHttp"
+
+var ErrorInternalDestination = fmt.Errorf("destination is inside the network")
+
+// publicClient forwards requests to destinations the allow-list does not
+// name, so it only connects to public addresses
+var publicClient = &client.Client{Transport: &client.Transport{
+	DialTimeout:     30 * time.Second,
+	MaxIdleConns:    100,
+	IdleConnTimeout: 90 * time.Second,
+	Control:         publicOnly,
+}}
+
+type ForwardProxyOptions struct {
+	// Allow lists the destinations clients may reach, as "host:port" or as
+	// "host" for any port. A host starting with "*." matches all of its
+	// subdomains. An empty list lets clients go anywhere public.
+	//
+	// Loopback, private, link-local and unspecified addresses can only be
+	// reached through an entry that names them, whatever host name
+	// resolves to them.
+	Allow []string
+	// Credentials maps user names to passwords for Proxy-Authorization
+	// basic auth. Without any, no authentication is asked for.
+	Credentials map[string]string
+	// Realm is sent in the Proxy-Authenticate challenge
+	Realm string
+	// DialTimeout limits how long connecting a CONNECT tunnel may take,
+	// 10 seconds when zero
+	DialTimeout time.Duration
+}
+
+// ForwardProxy returns a handler for clients that use this server as their
+// proxy. Requests with an absolute-form target are sent on to the origin
+// server, and CONNECT requests get a raw TCP tunnel to the host and port in
+// their authority-form target, which is how clients reach https sites.
+func ForwardProxy(opts ForwardProxyOptions) server.Handler {
+	if opts.Realm == "" {
+		opts.Realm = "proxy"
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 10 * time.Second
+	}
+
+	return func(w *response.Writer, req *request.Request) {
+		if !opts.authorized(req) {
+			_ = w.WriteError(server.NewHandlerError(response.StatusProxyAuthRequired, "").
+				WithHeader("Proxy-Authenticate", `Basic realm="`+opts.Realm+`"`))
+			return
+		}
+
+		if req.RequestLine.Method == "CONNECT" {
+			opts.tunnel(w, req)
+			return
+		}
+		opts.forward(w, req)
+	}
+}
+
+func (o *ForwardProxyOptions) authorized(req *request.Request) bool {
+	if len(o.Credentials) == 0 {
+		return true
+	}
+	auth, _ := req.Headers.Get("Proxy-Authorization")
+	scheme, encoded, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+	want, ok := o.Credentials[user]
+	return ok && subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+}
+
+// destination decides whether host and port may be reached, and whether
+// only at public addresses. Those are all that is left for destinations
+// the allow-list does not name.
+func (o *ForwardProxyOptions) destination(host, port string) (ok, public bool) {
+	if o.listed(host, port) {
+		return true, false
+	}
+	return len(o.Allow) == 0, true
+}
+
+// listed reports whether host and port are on the allow-list
+func (o *ForwardProxyOptions) listed(host, port string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range o.Allow {
+		entryHost, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			entryHost, entryPort = entry, ""
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		entryHost = strings.ToLower(entryHost)
+		if suffix, ok := strings.CutPrefix(entryHost, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == entryHost {
+			return true
+		}
+	}
+	return false
+}
+
+// forward sends an absolute-form request on to the origin server
+func (o *ForwardProxyOptions) forward(w *response.Writer, req *request.Request) {
+	target, err := url.Parse(req.RequestLine.RequestTarget)
+	if err != nil || target.Scheme != "http" || target.Host == "" {
+		// https goes through CONNECT, and origin-form is not meant for a proxy
+		_ = w.WriteError(server.NewHandlerError(response.StatusBad, "forward proxy requests need an absolute http URL"))
+		return
+	}
+	port := target.Port()
+	if port == "" {
+		port = "80"
+	}
+	ok, public := o.destination(target.Hostname(), port)
+	if !ok {
+		_ = w.WriteError(server.NewHandlerError(response.StatusForbidden, "destination not allowed"))
+		return
+	}
+
+	outReq, err := client.NewRequest(req.RequestLine.Method, target.String(), req.Body)
+	if err != nil {
+		_ = w.WriteError(server.NewHandlerError(response.StatusBad, err.Error()))
+		return
+	}
+	skip := connectionHeaders(req.Headers)
+	// the Host header comes from the target URL
+	skip["host"] = true
+	for key, val := range req.Headers {
+		if !skip[key] {
+			outReq.Headers.Set(key, val)
+		}
+	}
+	outReq.Headers.Set("Via", req.RequestLine.HTTPVersion+" "+viaPseudonym)
+
+	c := proxyClient
+	if public {
+		c = publicClient
+	}
+	resp, err := c.Do(req.Context(), outReq)
+	if err != nil {
+		_ = w.WriteError(dialError(err))
+		return
+	}
+	defer resp.Body.Close()
+	copyResponse(w, resp)
+}
+
+// tunnel connects to the authority-form target of a CONNECT request and
+// then relays bytes both ways until either side is done
+func (o *ForwardProxyOptions) tunnel(w *response.Writer, req *request.Request) {
+	host, port, err := net.SplitHostPort(req.RequestLine.RequestTarget)
+	if err != nil || host == "" || port == "" {
+		_ = w.WriteError(server.NewHandlerError(response.StatusBad, "CONNECT needs a host:port target"))
+		return
+	}
+	ok, public := o.destination(host, port)
+	if !ok {
+		_ = w.WriteError(server.NewHandlerError(response.StatusForbidden, "destination not allowed"))
+		return
+	}
+
+	dialer := net.Dialer{Timeout: o.DialTimeout}
+	if public {
+		dialer.Control = publicOnly
+	}
+	dest, err := dialer.DialContext(req.Context(), "tcp", req.RequestLine.RequestTarget)
+	if err != nil {
+		_ = w.WriteError(dialError(err))
+		return
+	}
+	defer dest.Close()
+
+	conn, buffered, err := w.Hijack()
+	if err != nil {
+		_ = w.WriteError(server.NewHandlerError(response.StatusInServErr, err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	// written on the raw connection so body filters can not add framing
+	// to it, but logs and metrics still see the answer
+	_ = w.RecordHijackedStatus(response.StatusOK)
+	// a 2xx answer to CONNECT has no body, the tunnel starts right after it
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+	// clients may start talking to the destination without waiting for us
+	if _, err := dest.Write(buffered); err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go relay(&wg, dest, conn)
+	go relay(&wg, conn, dest)
+	wg.Wait()
+}
+
+// publicOnly is a dialer Control that refuses addresses inside the network.
+// It runs once the host name is resolved, so names pointing inside are
+// caught too.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrorInternalDestination, ip)
+	}
+	return nil
+}
+
+// dialError is upstreamError, except that a destination refused by
+// publicOnly is forbidden rather than a bad gateway
+func dialError(err error) error {
+	if errors.Is(err, ErrorInternalDestination) {
+		return server.NewHandlerError(response.StatusForbidden, "destination not allowed")
+	}
+	return upstreamError(err)
+}
+
+// relay copies src to dst, and then tells dst no more is coming, so the
+// other direction can still finish
+func relay(wg *sync.WaitGroup, dst, src net.Conn) {
+	defer wg.Done()
+	_, _ = io.Copy(dst, src)
+	if c, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	// without half-close the whole tunnel goes down with this direction
+	dst.Close()
+	src.Close()
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/server"
+)
+
+// startProxy runs h on a real server, CONNECT needs a connection to hijack
+func startProxy(t *testing.T, h server.Handler) *url.URL {
+	srv, err := server.Serve(h, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	port := srv.Addr().(*net.TCPAddr).Port
+	return &url.URL{Scheme: "http", Host: "127.0.0.1:" + strconv.Itoa(port)}
+}
+
+// proxiedClient returns a client for origin that goes through proxy
+func proxiedClient(origin *httptest.Server, proxy *url.URL) *http.Client {
+	c := origin.Client()
+	c.Transport.(*http.Transport).Proxy = http.ProxyURL(proxy)
+	return c
+}
+
+func TestForwardProxy(t *testing.T) {
+	var gotVia string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotVia = r.Header.Get("Via")
+		_, _ = io.WriteString(w, "plain "+r.URL.Path)
+	}))
+	defer origin.Close()
+	tlsOrigin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "tunneled "+r.URL.Path)
+	}))
+	defer tlsOrigin.Close()
+
+	// the origins listen on loopback, which has to be listed to be reached
+	proxy := startProxy(t, ForwardProxy(ForwardProxyOptions{Allow: []string{"127.0.0.1"}}))
+
+	t.Run("absolute-form request", func(t *testing.T) {
+		resp, err := proxiedClient(origin, proxy).Get(origin.URL + "/hello")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "plain /hello", string(body))
+		assert.Equal(t, "1.1 goHttp", gotVia)
+	})
+
+	t.Run("CONNECT tunnel", func(t *testing.T) {
+		resp, err := proxiedClient(tlsOrigin, proxy).Get(tlsOrigin.URL + "/secret")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "tunneled /secret", string(body))
+	})
+
+	t.Run("origin-form is refused", func(t *testing.T) {
+		resp := serve(t, ForwardProxy(ForwardProxyOptions{}), "GET /hello HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+}
+
+func TestForwardProxyAccessControl(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer origin.Close()
+	originAddr := origin.Listener.Addr().String()
+
+	h := ForwardProxy(ForwardProxyOptions{
+		Allow:       []string{originAddr},
+		Credentials: map[string]string{"alice": "s3cret"},
+	})
+	proxy := startProxy(t, h)
+
+	t.Run("credentials are required", func(t *testing.T) {
+		resp, err := proxiedClient(origin, proxy).Get(origin.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 407, resp.StatusCode)
+		assert.Equal(t, `Basic realm="proxy"`, resp.Header.Get("Proxy-Authenticate"))
+
+		withAuth := *proxy
+		withAuth.User = url.UserPassword("alice", "wrong")
+		resp, err = proxiedClient(origin, &withAuth).Get(origin.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 407, resp.StatusCode)
+
+		withAuth.User = url.UserPassword("alice", "s3cret")
+		resp, err = proxiedClient(origin, &withAuth).Get(origin.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("destinations off the allow-list are refused", func(t *testing.T) {
+		auth := "Proxy-Authorization: Basic YWxpY2U6czNjcmV0\r\n"
+		resp := serve(t, h, "GET http://example.com/ HTTP/1.1\r\n"+auth+"\r\n")
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = serve(t, h, "CONNECT example.com:443 HTTP/1.1\r\n"+auth+"\r\n")
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("internal addresses need an entry", func(t *testing.T) {
+		anywhere := ForwardProxy(ForwardProxyOptions{})
+		for _, raw := range []string{
+			"GET " + origin.URL + "/ HTTP/1.1\r\n\r\n",
+			// names that resolve to loopback are caught when dialing
+			"GET http://localhost:" + strconv.Itoa(origin.Listener.Addr().(*net.TCPAddr).Port) + "/ HTTP/1.1\r\n\r\n",
+			"CONNECT " + originAddr + " HTTP/1.1\r\n\r\n",
+		} {
+			resp := serve(t, anywhere, raw)
+			assert.Equal(t, 403, resp.StatusCode, raw)
+		}
+	})
+
+	t.Run("allow-list entries", func(t *testing.T) {
+		opts := ForwardProxyOptions{Allow: []string{"example.com:443", "*.internal", "10.0.0.1"}}
+		assert.True(t, opts.listed("example.com", "443"))
+		assert.True(t, opts.listed("EXAMPLE.com", "443"))
+		assert.False(t, opts.listed("example.com", "80"))
+		assert.True(t, opts.listed("db.internal", "5432"))
+		assert.False(t, opts.listed("internal", "80"))
+		assert.True(t, opts.listed("10.0.0.1", "22"))
+		assert.False(t, opts.listed("10.0.0.2", "22"))
+
+		ok, public := opts.destination("10.0.0.1", "22")
+		assert.True(t, ok)
+		assert.False(t, public)
+		_, public = opts.destination("db.internal", "5432")
+		assert.False(t, public)
+
+		ok, public = (&ForwardProxyOptions{}).destination("example.com", "80")
+		assert.True(t, ok)
+		assert.True(t, public)
+	})
+
+	t.Run("public addresses", func(t *testing.T) {
+		for _, addr := range []string{"127.0.0.1:80", "[::1]:80", "10.1.2.3:80", "192.168.0.1:80", "169.254.169.254:80", "0.0.0.0:80", "[::ffff:127.0.0.1]:80", "[fe80::1]:80"} {
+			assert.ErrorIs(t, publicOnly("tcp", addr, nil), ErrorInternalDestination, addr)
+		}
+		for _, addr := range []string{"93.184.216.34:80", "[2606:2800:220:1::]:443"} {
+			assert.NoError(t, publicOnly("tcp", addr, nil), addr)
+		}
+	})
+}
@@ -1,14 +1,13 @@
 package handlers
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
 
+	"goHttp/internal/client"
 	"goHttp/internal/headers"
 	"goHttp/internal/request"
 	"goHttp/internal/response"
@@ -40,20 +39,54 @@ func Handler(w *response.Writer, req *request.Request) {
 	// server.WriteResponse(w, status, heads, body)
 
 	if err := w.WriteStatusLine(status); err != nil {
-		fmt.Printf("error writing status line: %v", err)
+		w.Logger().Error("writing status line", "err", err)
 		return
 	}
 	if err := w.WriteHeaders(heads); err != nil {
-		fmt.Printf("error writing headers: %v", err)
+		w.Logger().Error("writing headers", "err", err)
 		return
 	}
 	if _, err := w.WriteBody([]byte(body)); err != nil {
-		fmt.Printf("error writing body: %v", err)
+		w.Logger().Warn("writing body", "err", err)
 		return
 	}
 }
 
+// HTTPBinURL is where ProxyHandler and ProxyHandlerWithTrailers send
+// requests under /httpbin/
+const HTTPBinURL = "https://httpbin.org"
+
+// HTTPBinProxy is the proxy demo: requests under /httpbin/ are sent on to
+// an httpbin, everything else gets the default page
+type HTTPBinProxy struct {
+	proxy *ReverseProxy
+}
+
+// NewHTTPBinProxy returns an HTTPBinProxy for the httpbin at upstream. Point
+// it at a server running HTTPBin to use the demos without network access.
+func NewHTTPBinProxy(upstream string) (*HTTPBinProxy, error) {
+	proxy, err := NewReverseProxy(upstream, "/httpbin")
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPBinProxy{proxy: proxy}, nil
+}
+
+var defaultHTTPBinProxy, _ = NewHTTPBinProxy(HTTPBinURL)
+
+// ProxyHandler is HTTPBinProxy.ServeRequest for httpbin.org
 func ProxyHandler(w *response.Writer, req *request.Request) {
+	defaultHTTPBinProxy.ServeRequest(w, req)
+}
+
+// ProxyHandlerWithTrailers is HTTPBinProxy.ServeRequestWithTrailers for
+// httpbin.org
+func ProxyHandlerWithTrailers(w *response.Writer, req *request.Request) {
+	defaultHTTPBinProxy.ServeRequestWithTrailers(w, req)
+}
+
+// ServeRequest streams the httpbin's response back as it is
+func (p *HTTPBinProxy) ServeRequest(w *response.Writer, req *request.Request) {
 	httpBinPrefix := "/httpbin/"
 	redirect := strings.HasPrefix(req.RequestLine.RequestTarget, httpBinPrefix)
 
@@ -68,58 +101,12 @@ func ProxyHandler(w *response.Writer, req *request.Request) {
 		return
 	}
 
-	// make request to httpbin to get content
-	redirTarget := strings.TrimPrefix(req.RequestLine.RequestTarget, httpBinPrefix)
-	resp, err := http.Get("https://httpbin.org/" + redirTarget)
-	if err != nil {
-		fmt.Printf("error getting response from https://httpbin.org/: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	heads := headers.NewHeaders()
-	heads.Set("Content-Type", "text/plain")
-	heads.Set("Transfer-Encoding", "chunked")
-	heads.Set("Connection", "close") // probably not needed...
-
-	if err = w.WriteStatusLine(response.StatusOK); err != nil {
-		fmt.Printf("error writing status line: %v", err)
-		return
-	}
-	if err = w.WriteHeaders(heads); err != nil {
-		fmt.Printf("error writing headers: %v", err)
-		return
-	}
-
-	chunk := make([]byte, 1024)
-	for {
-		n, err := resp.Body.Read(chunk)
-		fmt.Printf("read %d bytes:\n%s\n", n, string(chunk[:n]))
-
-		if n > 0 {
-			// only write however many bytes we read from current Read() call
-			if _, werr := w.WriteChunkedBody(chunk[:n]); werr != nil {
-				fmt.Printf("error writing chunk: %v\n", werr)
-				return
-			}
-		}
-
-		if err == io.EOF {
-			break
-		}
-
-		// unexpected error
-		if err != nil {
-			fmt.Printf("error reading response: %v", err)
-			break
-		}
-	}
-	_, _ = w.WriteChunkedBodyDone()
-	fmt.Println("finished writing all chunks to the body :)")
-	fmt.Println("ready for a new connection...")
+	p.proxy.ServeRequest(w, req)
 }
 
-func ProxyHandlerWithTrailers(w *response.Writer, req *request.Request) {
+// ServeRequestWithTrailers relays the httpbin's body and ends it with
+// trailers carrying its length and SHA-256
+func (p *HTTPBinProxy) ServeRequestWithTrailers(w *response.Writer, req *request.Request) {
 	httpBinPrefix := "/httpbin/"
 	redirect := strings.HasPrefix(req.RequestLine.RequestTarget, httpBinPrefix)
 
@@ -137,108 +124,61 @@ func ProxyHandlerWithTrailers(w *response.Writer, req *request.Request) {
 
 	// make request to httpbin to get content
 	redirTarget := strings.TrimPrefix(req.RequestLine.RequestTarget, httpBinPrefix)
-	resp, err := http.Get("https://httpbin.org/" + redirTarget)
+	upstream := p.proxy.Upstream.String()
+	resp, err := client.Get(req.Context(), strings.TrimSuffix(upstream, "/")+"/"+redirTarget)
 	if err != nil {
-		fmt.Printf("error getting response from https://httpbin.org/: %v", err)
+		w.Logger().Error("fetching from httpbin", "upstream", upstream, "err", err)
+		_ = w.WriteError(server.NewHandlerError(response.StatusBadGateway, ""))
 		return
 	}
 	defer resp.Body.Close()
 
 	heads := headers.NewHeaders()
 	heads.Set("Content-Type", "text/plain")
-	heads.Set("Transfer-Encoding", "chunked")
 	heads.Set("Connection", "close") // probably not needed...
-	heads.Set("Trailer", "X-Content-SHA256")
-	heads.Set("Trailer", "X-Content-Length")
 
+	// the values are only known once the whole body went out
+	if err = w.DeclareTrailer("X-Content-SHA256", "X-Content-Length"); err != nil {
+		w.Logger().Error("declaring trailers", "err", err)
+		return
+	}
 	if err = w.WriteStatusLine(response.StatusOK); err != nil {
-		fmt.Printf("error writing status line: %v", err)
+		w.Logger().Error("writing status line", "err", err)
 		return
 	}
 	if err = w.WriteHeaders(heads); err != nil {
-		fmt.Printf("error writing headers: %v", err)
+		w.Logger().Error("writing headers", "err", err)
 		return
 	}
 
-	chunk := make([]byte, 1024)
-	var total bytes.Buffer
-	for {
-		n, err := resp.Body.Read(chunk)
-		fmt.Printf("read %d bytes:\n%s\n", n, string(chunk[:n]))
-
-		if n > 0 {
-			// accumulate read bytes
-			total.Write(chunk[:n])
-
-			// only write however many bytes we read from current Read() call
-			if _, werr := w.WriteChunkedBody(chunk[:n]); werr != nil {
-				fmt.Printf("error writing chunk: %v\n", werr)
-				return
-			}
-		}
-
-		if err == io.EOF {
-			break
-		}
-
-		// actual unexpected error
-		if err != nil {
-			fmt.Printf("error reading response: %v", err)
-			break
-		}
+	// hashed as it streams through instead of keeping the whole body around
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w.BodyWriter(), hash), resp.Body)
+	if err != nil {
+		w.Logger().Warn("relaying response", "err", err)
 	}
-	_, _ = w.WriteChunkedBodyDoneWithTrailers()
 
-	trails := headers.NewHeaders()
-	hash := sha256.Sum256(total.Bytes())
-	trails.Set("X-Content-SHA256", fmt.Sprintf("%X", hash))
-	trails.Set("X-Content-Length", fmt.Sprintf("%d", total.Len()))
-	if err = w.WriteTrailers(trails); err != nil {
-		fmt.Printf("error writing trailers: %v", err)
+	_ = w.SetTrailer("X-Content-SHA256", fmt.Sprintf("%X", hash.Sum(nil)))
+	_ = w.SetTrailer("X-Content-Length", fmt.Sprintf("%d", n))
+	if err = w.Finish(); err != nil {
+		w.Logger().Warn("writing trailers", "err", err)
 		return
 	}
 
-	fmt.Println("finished writing all chunks to the body and the trailers :)")
-	fmt.Println("ready for a new connection...")
+	w.Logger().Debug("relayed response with trailers", "bytes", n)
 }
 
 func BinaryDataHandler(w *response.Writer, req *request.Request) {
-	status := response.StatusOK
-	body := response.StatusOKBody
-	vid := req.RequestLine.RequestTarget == "/video"
-	var payload []byte
-	var contentType string
-
-	if vid {
-		wd, err := os.Getwd()
-		if err != nil {
-			fmt.Printf("error getting working dir: %v\n", err)
-			return
-		}
-
-		payload, err = os.ReadFile(wd + "/assets/vim.mp4")
-		if err != nil {
-			fmt.Printf("error reading video file: %v", err)
-			return
-		}
-		contentType = "video/mp4"
-	} else {
-		payload = []byte(body)
-		contentType = "text/html"
+	if req.RequestLine.RequestTarget == "/video" {
+		// streamed straight off disk instead of being read into memory first
+		serveFile(w, req, os.DirFS("assets"), "vim.mp4", false)
+		return
 	}
 
-	heads := response.GetDefaultHeaders(len(payload))
-	if err := heads.Update("Content-Type", contentType); err != nil {
+	body := response.StatusOKBody
+	heads := response.GetDefaultHeaders(len(body))
+	if err := heads.Update("Content-Type", "text/html"); err != nil {
 		panic("failed to update Content-Type")
 	}
-
-	if err := w.WriteStatusLine(status); err != nil {
-		fmt.Printf("error writing headers: %v\n", err)
-	}
-	if err := w.WriteHeaders(heads); err != nil {
-		fmt.Printf("error writing headers: %v\n", err)
-	}
-	if _, err := w.WriteBody(payload); err != nil {
-		fmt.Printf("error writing headers: %v\n", err)
-	}
+	server.WriteResponse(w, response.StatusOK, heads, body)
 }
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// limits that keep a single request to the stand-in cheap, the same ones
+// httpbin.org applies
+const (
+	maxStreamLines = 100
+	maxDelay       = 10 * time.Second
+	maxBytes       = 100 * 1024
+	maxDripTime    = 10 * time.Second
+)
+
+// HTTPBin returns a handler that answers like the httpbin.org endpoints the
+// demos and proxy tests use: /get, /post, /status/{code}, /stream/{n},
+// /delay/{s}, /bytes/{n}, /headers, /redirect/{n} and /drip.
+func HTTPBin() server.Handler {
+	mux := server.NewMux()
+	mux.Handle("GET", "/get", binGet)
+	mux.Handle("POST", "/post", binPost)
+	mux.Handle("GET", "/headers", binHeaders)
+	mux.Handle("", "/status/", binStatus)
+	mux.Handle("GET", "/stream/", binStream)
+	mux.Handle("", "/delay/", binDelay)
+	mux.Handle("GET", "/bytes/", binBytes)
+	mux.Handle("GET", "/redirect/", binRedirect)
+	mux.Handle("GET", "/drip", binDrip)
+	return mux.ServeRequest
+}
+
+// binRequest is what httpbin echoes back about a request
+type binRequest struct {
+	Args    map[string]string `json:"args"`
+	Headers map[string]string `json:"headers"`
+	Origin  string            `json:"origin"`
+	URL     string            `json:"url"`
+	// only filled in for requests with a body
+	Data  *string           `json:"data,omitempty"`
+	Form  map[string]string `json:"form,omitempty"`
+	JSON  any               `json:"json,omitempty"`
+	Files map[string]string `json:"files,omitempty"`
+}
+
+func describe(req *request.Request) binRequest {
+	desc := binRequest{
+		Args:    map[string]string{},
+		Headers: binHeaderMap(req.Headers),
+		Origin:  req.RemoteAddr,
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		desc.Origin = host
+	}
+
+	target := req.RequestLine.RequestTarget
+	if u, err := url.ParseRequestURI(target); err == nil {
+		for key, vals := range u.Query() {
+			desc.Args[key] = strings.Join(vals, ",")
+		}
+		if u.Host == "" {
+			host, _ := req.Headers.Get("Host")
+			u.Scheme, u.Host = "http", host
+			if req.TLS != nil {
+				u.Scheme = "https"
+			}
+		}
+		target = u.String()
+	}
+	desc.URL = target
+	return desc
+}
+
+// binHeaderMap puts header names back into their usual spelling
+func binHeaderMap(h headers.Headers) map[string]string {
+	out := make(map[string]string, len(h))
+	for key, val := range h {
+		out[textproto.CanonicalMIMEHeaderKey(key)] = val
+	}
+	return out
+}
+
+func writeBinJSON(w *response.Writer, status response.StatusCode, v any) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		_ = w.WriteError(err)
+		return
+	}
+	body = append(body, '\n')
+
+	heads := response.GetDefaultHeaders(len(body))
+	_ = heads.Update("Content-Type", "application/json")
+	heads.Set("Access-Control-Allow-Origin", "*")
+	server.WriteResponse(w, status, heads, string(body))
+}
+
+// pathParam returns what follows prefix in the request path, as an int
+func pathParam(req *request.Request, prefix string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(req.Path(), prefix))
+	if err != nil {
+		return 0, server.NewHandlerError(response.StatusNotFound, "expected a number after "+prefix)
+	}
+	return n, nil
+}
+
+func binGet(w *response.Writer, req *request.Request) {
+	writeBinJSON(w, response.StatusOK, describe(req))
+}
+
+func binPost(w *response.Writer, req *request.Request) {
+	desc := describe(req)
+	data := string(req.Body)
+	desc.Data = &data
+	desc.Form = map[string]string{}
+	desc.Files = map[string]string{}
+
+	contentType, _ := req.Headers.Get("Content-Type")
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(mediaType)) {
+	case "application/x-www-form-urlencoded":
+		if form, err := url.ParseQuery(data); err == nil {
+			for key, vals := range form {
+				desc.Form[key] = strings.Join(vals, ",")
+			}
+		}
+	case "application/json":
+		// invalid JSON is still echoed back in data
+		_ = json.Unmarshal(req.Body, &desc.JSON)
+	}
+	writeBinJSON(w, response.StatusOK, desc)
+}
+
+func binHeaders(w *response.Writer, req *request.Request) {
+	writeBinJSON(w, response.StatusOK, map[string]any{"headers": binHeaderMap(req.Headers)})
+}
+
+// binStatus answers with the status in the path and an empty body
+func binStatus(w *response.Writer, req *request.Request) {
+	code, err := pathParam(req, "/status/")
+	if err != nil {
+		_ = w.WriteError(err)
+		return
+	}
+	if code < 200 || code > 599 {
+		_ = w.WriteError(server.NewHandlerError(response.StatusBad, "status has to be between 200 and 599"))
+		return
+	}
+
+	heads := response.GetDefaultHeaders(0)
+	switch {
+	case code >= 300 && code < 400 && code != int(response.StatusNotModified):
+		heads.Set("Location", "/redirect/1")
+	case code == int(response.StatusUnauthorized):
+		heads.Set("WWW-Authenticate", `Basic realm="Fake Realm"`)
+	}
+	server.WriteResponse(w, response.StatusCode(code), heads, "")
+}
+
+// binStream sends n lines of JSON, each one a chunk of its own
+func binStream(w *response.Writer, req *request.Request) {
+	n, err := pathParam(req, "/stream/")
+	if err != nil {
+		_ = w.WriteError(err)
+		return
+	}
+	n = min(max(n, 0), maxStreamLines)
+
+	heads := headers.NewHeaders()
+	heads.Set("Content-Type", "application/json")
+	heads.Set("Transfer-Encoding", "chunked")
+	if err := w.WriteStatusLine(response.StatusOK); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return
+	}
+
+	desc := describe(req)
+	for i := range n {
+		line, _ := json.Marshal(struct {
+			ID int `json:"id"`
+			binRequest
+		}{i, desc})
+		if _, err := w.WriteChunkedBody(append(line, '\n')); err != nil {
+			return
+		}
+	}
+	_, _ = w.WriteChunkedBodyDone()
+}
+
+// binDelay waits the seconds in the path, up to ten, before answering
+func binDelay(w *response.Writer, req *request.Request) {
+	secs, err := strconv.ParseFloat(strings.TrimPrefix(req.Path(), "/delay/"), 64)
+	if err != nil || secs < 0 || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		_ = w.WriteError(server.NewHandlerError(response.StatusNotFound, "expected a number of seconds"))
+		return
+	}
+	// capped before converting, a huge number of seconds overflows Duration
+	if !wait(req, time.Duration(min(secs, maxDelay.Seconds())*float64(time.Second))) {
+		return
+	}
+	binGet(w, req)
+}
+
+// wait pauses for d, reporting false when the request's context ends first
+// because the client went away or the request timed out
+func wait(req *request.Request, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// binBytes sends n random bytes, the same ones for the same ?seed=
+func binBytes(w *response.Writer, req *request.Request) {
+	n, err := pathParam(req, "/bytes/")
+	if err != nil {
+		_ = w.WriteError(err)
+		return
+	}
+	n = min(max(n, 0), maxBytes)
+
+	seed := time.Now().UnixNano()
+	if u, err := url.ParseRequestURI(req.RequestLine.RequestTarget); err == nil {
+		if s, err := strconv.ParseInt(u.Query().Get("seed"), 10, 64); err == nil {
+			seed = s
+		}
+	}
+	body := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(body)
+
+	heads := response.GetDefaultHeaders(n)
+	_ = heads.Update("Content-Type", "application/octet-stream")
+	server.WriteResponse(w, response.StatusOK, heads, string(body))
+}
+
+// binRedirect redirects n times before landing on /get
+func binRedirect(w *response.Writer, req *request.Request) {
+	n, err := pathParam(req, "/redirect/")
+	if err != nil || n < 1 {
+		_ = w.WriteError(server.NewHandlerError(response.StatusNotFound, "expected a positive number of redirects"))
+		return
+	}
+
+	location := "/get"
+	if n > 1 {
+		location = "/redirect/" + strconv.Itoa(n-1)
+	}
+	heads := response.GetDefaultHeaders(0)
+	heads.Set("Location", location)
+	server.WriteResponse(w, response.StatusFound, heads, "")
+}
+
+// binDrip sends numbytes asterisks spread out over duration seconds, after
+// waiting delay seconds, with the status given by code
+func binDrip(w *response.Writer, req *request.Request) {
+	query := url.Values{}
+	if u, err := url.ParseRequestURI(req.RequestLine.RequestTarget); err == nil {
+		query = u.Query()
+	}
+	// number is capped at limit before anything converts it, values too
+	// large for an int or a Duration would overflow
+	number := func(name string, def, limit float64) float64 {
+		v, err := strconv.ParseFloat(query.Get(name), 64)
+		if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return def
+		}
+		return min(v, limit)
+	}
+
+	duration := time.Duration(number("duration", 2, maxDripTime.Seconds()) * float64(time.Second))
+	delay := time.Duration(number("delay", 2, maxDelay.Seconds()) * float64(time.Second))
+	numBytes := int(number("numbytes", 10, maxBytes))
+	// capped just past the last valid code, so larger ones are still refused
+	code := int(number("code", 200, 600))
+	if code < 200 || code > 599 {
+		_ = w.WriteError(server.NewHandlerError(response.StatusBad, "code has to be between 200 and 599"))
+		return
+	}
+
+	if !wait(req, delay) {
+		return
+	}
+	heads := response.GetDefaultHeaders(numBytes)
+	_ = heads.Update("Content-Type", "application/octet-stream")
+	if err := w.WriteStatusLine(response.StatusCode(code)); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return
+	}
+
+	var pause time.Duration
+	if numBytes > 0 {
+		pause = duration / time.Duration(numBytes)
+	}
+	for i := range numBytes {
+		if i > 0 && !wait(req, pause) {
+			return
+		}
+		if _, err := w.WriteBody([]byte("*")); err != nil {
+			return
+		}
+		// every byte goes out on its own, that is the point of dripping
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+func TestHTTPBin(t *testing.T) {
+	bin := HTTPBin()
+	decode := func(t *testing.T, r io.Reader) map[string]any {
+		t.Helper()
+		var v map[string]any
+		require.NoError(t, json.NewDecoder(r).Decode(&v))
+		return v
+	}
+
+	t.Run("get", func(t *testing.T) {
+		resp := serve(t, bin, "GET /get?a=1&a=2&b=x HTTP/1.1\r\nHost: bin.test\r\nX-Thing: yes\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		v := decode(t, resp.Body)
+		assert.Equal(t, map[string]any{"a": "1,2", "b": "x"}, v["args"])
+		assert.Equal(t, "yes", v["headers"].(map[string]any)["X-Thing"])
+		assert.Equal(t, "http://bin.test/get?a=1&a=2&b=x", v["url"])
+	})
+
+	t.Run("post", func(t *testing.T) {
+		resp := serve(t, bin, "POST /post HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 9\r\n\r\n"+`{"n": 42}`)
+		v := decode(t, resp.Body)
+		assert.Equal(t, `{"n": 42}`, v["data"])
+		assert.Equal(t, map[string]any{"n": float64(42)}, v["json"])
+
+		resp = serve(t, bin, "POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 7\r\n\r\nk=v&x=y")
+		v = decode(t, resp.Body)
+		assert.Equal(t, map[string]any{"k": "v", "x": "y"}, v["form"])
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		resp := serve(t, bin, "GET /headers HTTP/1.1\r\nUser-Agent: tester\r\n\r\n")
+		v := decode(t, resp.Body)
+		assert.Equal(t, map[string]any{"User-Agent": "tester"}, v["headers"])
+	})
+
+	t.Run("status", func(t *testing.T) {
+		resp := serve(t, bin, "DELETE /status/418 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 418, resp.StatusCode)
+		resp = serve(t, bin, "GET /status/302 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, "/redirect/1", resp.Header.Get("Location"))
+		resp = serve(t, bin, "GET /status/abc HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		resp := serve(t, bin, "GET /stream/3 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		body, _ := io.ReadAll(resp.Body)
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[2], `"id":2`)
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		resp := serve(t, bin, "GET /delay/0 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		resp := serve(t, bin, "GET /bytes/64?seed=7 HTTP/1.1\r\n\r\n")
+		first, _ := io.ReadAll(resp.Body)
+		assert.Len(t, first, 64)
+		resp = serve(t, bin, "GET /bytes/64?seed=7 HTTP/1.1\r\n\r\n")
+		second, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		resp := serve(t, bin, "GET /redirect/3 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 302, resp.StatusCode)
+		assert.Equal(t, "/redirect/2", resp.Header.Get("Location"))
+		resp = serve(t, bin, "GET /redirect/1 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, "/get", resp.Header.Get("Location"))
+	})
+
+	t.Run("drip", func(t *testing.T) {
+		resp := serve(t, bin, "GET /drip?numbytes=5&duration=0&delay=0&code=201 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 201, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "*****", string(body))
+	})
+
+	t.Run("numbers out of range", func(t *testing.T) {
+		for _, target := range []string{"/delay/inf", "/delay/NaN", "/delay/-inf"} {
+			resp := serve(t, bin, "GET "+target+" HTTP/1.1\r\n\r\n")
+			assert.Equal(t, 404, resp.StatusCode, target)
+		}
+
+		resp := serve(t, bin, "GET /drip?numbytes=1e300&duration=0&delay=0 HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+		assert.Len(t, body, maxBytes)
+
+		resp = serve(t, bin, "GET /drip?numbytes=inf&duration=nan&delay=0 HTTP/1.1\r\n\r\n")
+		body, _ = io.ReadAll(resp.Body)
+		assert.Equal(t, "**********", string(body))
+
+		resp = serve(t, bin, "GET /drip?code=1e300&delay=0 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("waits end with the request", func(t *testing.T) {
+		for _, target := range []string{"/delay/10", "/delay/1e300", "/drip?delay=10", "/drip?delay=1e300", "/drip?delay=0&duration=10&numbytes=2"} {
+			req, err := request.RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\n\r\n"))
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(req.Context(), 20*time.Millisecond)
+			defer cancel()
+
+			w := response.NewWriter(io.Discard)
+			start := time.Now()
+			bin(w, req.WithContext(ctx))
+			assert.Less(t, time.Since(start), time.Second, target)
+			assert.LessOrEqual(t, w.BytesWritten(), int64(1), target)
+		}
+	})
+}
+
+// the proxy demos run against a local stand-in instead of httpbin.org
+func TestProxyHandlersOffline(t *testing.T) {
+	bin := startProxy(t, HTTPBin())
+	p, err := NewHTTPBinProxy(bin.String())
+	require.NoError(t, err)
+
+	t.Run("ServeRequest", func(t *testing.T) {
+		resp := serve(t, p.ServeRequest, "GET /httpbin/status/404 HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("ServeRequestWithTrailers", func(t *testing.T) {
+		resp := serve(t, p.ServeRequestWithTrailers, "GET /httpbin/bytes/2048?seed=1 HTTP/1.1\r\n\r\n")
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Len(t, body, 2048)
+		assert.Equal(t, fmt.Sprintf("%X", sha256.Sum256(body)), resp.Trailer.Get("X-Content-SHA256"))
+		assert.Equal(t, "2048", resp.Trailer.Get("X-Content-Length"))
+	})
+}
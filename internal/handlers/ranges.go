@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+var (
+	ErrorInvalidRange   = fmt.Errorf("found an invalid byte range")
+	ErrorRangeNoOverlap = fmt.Errorf("byte ranges do not overlap the content")
+)
+
+// byteRange is a resolved range of a representation: length bytes from start
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange resolves a Range header value against content of the given size
+// (RFC 9110 section 14.1.2). Ranges that start past the end are dropped, and
+// ErrorRangeNoOverlap is returned when nothing is left after that.
+func parseRange(value string, size int64) ([]byteRange, error) {
+	unit, spec, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, ErrorInvalidRange
+	}
+
+	var ranges []byteRange
+	noOverlap := false
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, ErrorInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+		if first == "" {
+			// suffix range "-N" asks for the last N bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrorInvalidRange
+			}
+			if n == 0 {
+				noOverlap = true
+				continue
+			}
+			n = min(n, size)
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, ErrorInvalidRange
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, ErrorInvalidRange
+				}
+				end = min(end, size-1)
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, ErrorRangeNoOverlap
+		}
+		return nil, ErrorInvalidRange
+	}
+	return ranges, nil
+}
+
+// ifRangeMatches reports whether the If-Range precondition, if any, lets a
+// range request through. It holds when the value is a strong entity tag equal
+// to etag, or a date equal to lastModified.
+func ifRangeMatches(req *request.Request, etag string, lastModified time.Time) bool {
+	ifRange, _ := req.Headers.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// weak tags never match here (RFC 9110 section 13.1.5)
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+
+	t, err := time.Parse(headers.TimeFormat, ifRange)
+	return err == nil && !lastModified.IsZero() && t.Equal(lastModified.Truncate(time.Second))
+}
+
+// serveRanges answers a Range request for content with a 206, or with a 416
+// when none of the ranges can be satisfied. heads are the headers the full
+// response would have been sent with. It returns false when the request
+// should just get the whole content instead.
+func serveRanges(w *response.Writer, req *request.Request, content io.ReadSeeker, size int64, heads headers.Headers) bool {
+	rangeHeader, _ := req.Headers.Get("Range")
+	ranges, err := parseRange(rangeHeader, size)
+	if errors.Is(err, ErrorInvalidRange) {
+		// a malformed Range header gets ignored, not rejected
+		return false
+	}
+	contentType, _ := heads.Get("Content-Type")
+
+	if errors.Is(err, ErrorRangeNoOverlap) {
+		_ = heads.Update("Content-Type", "text/plain")
+		heads.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		body := response.StatusText(response.StatusRequestedRangeNotSatisfiable)
+		_ = heads.Update("Content-Length", strconv.Itoa(len(body)))
+		if err := w.WriteStatusLine(response.StatusRequestedRangeNotSatisfiable); err != nil {
+			return true
+		}
+		if err := w.WriteHeaders(heads); err != nil {
+			return true
+		}
+		_, _ = w.WriteBody([]byte(body))
+		return true
+	}
+
+	// asking for more than the whole thing, likely through lots of small or
+	// overlapping ranges, is not worth the overhead of answering in parts
+	var total int64
+	for _, r := range ranges {
+		total += r.length
+	}
+	if total > size {
+		return false
+	}
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		_ = heads.Update("Content-Length", strconv.FormatInt(r.length, 10))
+		heads.Set("Content-Range", r.contentRange(size))
+
+		if err := w.WriteStatusLine(response.StatusPartialContent); err != nil {
+			return true
+		}
+		if err := w.WriteHeaders(heads); err != nil {
+			return true
+		}
+		if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+			return true
+		}
+		_, _ = w.WriteBodyFrom(io.LimitReader(content, r.length))
+		return true
+	}
+
+	// several ranges go out as multipart/byteranges, one part per range
+	mw := multipart.NewWriter(w.BodyWriter())
+	partHeaders := make([]textproto.MIMEHeader, len(ranges))
+	for i, r := range ranges {
+		partHeaders[i] = textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {r.contentRange(size)},
+		}
+	}
+
+	_ = heads.Update("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	_ = heads.Update("Content-Length", strconv.FormatInt(multipartLength(mw.Boundary(), partHeaders, ranges), 10))
+	if err := w.WriteStatusLine(response.StatusPartialContent); err != nil {
+		return true
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return true
+	}
+
+	for i, r := range ranges {
+		part, err := mw.CreatePart(partHeaders[i])
+		if err != nil {
+			return true
+		}
+		if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+			return true
+		}
+		if _, err := io.CopyN(part, content, r.length); err != nil {
+			return true
+		}
+	}
+	_ = mw.Close()
+	return true
+}
+
+// multipartLength works out the size of a multipart/byteranges body up front
+// by writing only the framing to a counter, so we can send a Content-Length
+func multipartLength(boundary string, partHeaders []textproto.MIMEHeader, ranges []byteRange) int64 {
+	var counter countingWriter
+	mw := multipart.NewWriter(&counter)
+	_ = mw.SetBoundary(boundary)
+	for i, r := range ranges {
+		_, _ = mw.CreatePart(partHeaders[i])
+		counter.n += r.length
+	}
+	_ = mw.Close()
+	return counter.n
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
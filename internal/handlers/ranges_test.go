@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		value string
+		want  []byteRange
+		err   error
+	}{
+		{"bytes=0-4", []byteRange{{0, 5}}, nil},
+		{"bytes=5-", []byteRange{{5, 5}}, nil},
+		{"bytes=-3", []byteRange{{7, 3}}, nil},
+		{"bytes=-30", []byteRange{{0, 10}}, nil},
+		{"bytes=8-20", []byteRange{{8, 2}}, nil},
+		{"bytes=0-1, 4-5", []byteRange{{0, 2}, {4, 2}}, nil},
+		{"bytes=0-1,20-30", []byteRange{{0, 2}}, nil},
+		{"bytes=20-30", nil, ErrorRangeNoOverlap},
+		{"bytes=-0", nil, ErrorRangeNoOverlap},
+		{"bytes=5-1", nil, ErrorInvalidRange},
+		{"bytes=abc", nil, ErrorInvalidRange},
+		{"items=0-1", nil, ErrorInvalidRange},
+		{"bytes=", nil, ErrorInvalidRange},
+	}
+	for _, c := range cases {
+		got, err := parseRange(c.value, 10)
+		assert.Equal(t, c.err, err, c.value)
+		assert.Equal(t, c.want, got, c.value)
+	}
+}
+
+func TestFileServerRanges(t *testing.T) {
+	h := FileServer(testFS, FileServerOptions{})
+
+	t.Run("advertises ranges", func(t *testing.T) {
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\n\r\n")
+		assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	})
+
+	t.Run("single range", func(t *testing.T) {
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=2-5\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 206, resp.StatusCode)
+		assert.Equal(t, "bytes 2-5/10", resp.Header.Get("Content-Range"))
+		assert.Equal(t, "4", resp.Header.Get("Content-Length"))
+		assert.Equal(t, "2345", string(body))
+	})
+
+	t.Run("multiple ranges", func(t *testing.T) {
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=0-1,-2\r\n\r\n")
+		assert.Equal(t, 206, resp.StatusCode)
+
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/byteranges", mediaType)
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, resp.ContentLength, int64(len(body)))
+
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		var parts []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, _ := io.ReadAll(part)
+			parts = append(parts, part.Header.Get("Content-Range")+" "+string(data))
+		}
+		assert.Equal(t, []string{"bytes 0-1/10 01", "bytes 8-9/10 89"}, parts)
+	})
+
+	t.Run("unsatisfiable", func(t *testing.T) {
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=50-\r\n\r\n")
+		assert.Equal(t, 416, resp.StatusCode)
+		assert.Equal(t, "bytes */10", resp.Header.Get("Content-Range"))
+	})
+
+	t.Run("malformed range is ignored", func(t *testing.T) {
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=x-y\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("If-Range", func(t *testing.T) {
+		resp := serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=0-0\r\n"+
+			"If-Range: Fri, 01 Mar 2024 12:00:00 GMT\r\n\r\n")
+		assert.Equal(t, 206, resp.StatusCode)
+
+		// anything that does not match the current version gets the whole file
+		resp = serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=0-0\r\n"+
+			"If-Range: Sat, 02 Mar 2024 12:00:00 GMT\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+		resp = serve(t, h, "GET /digits.txt HTTP/1.1\r\nRange: bytes=0-0\r\nIf-Range: \"abc\"\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"goHttp/internal/client"
+	"goHttp/internal/headers"
+	"goHttp/internal/metrics"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/upstream"
+)
+
+// hopHeaders only mean something for a single connection, so a proxy must not
+// pass them on (RFC 9110 section 7.6.1)
+var hopHeaders = []string{
+	"connection",
+	"proxy-connection",
+	"keep-alive",
+	"proxy-authenticate",
+	"proxy-authorization",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
+}
+
+// proxyClient leaves redirects and content codings alone,
+// both are the client's business and not ours
+var proxyClient = &client.Client{}
+
+// ReverseProxy forwards requests to an upstream server and streams its
+// response back: method, headers, body, status and trailers all make the
+// trip, minus the hop-by-hop headers.
+//
+// Only the response is streamed. The request body was read into memory
+// whole by the time the proxy runs, and bodies over request.MaxBodyBytes
+// are refused with 413 before they get this far.
+type ReverseProxy struct {
+	// Upstream is the server requests are sent to. Its path, if any,
+	// is put in front of the request path.
+	Upstream *url.URL
+	// StripPrefix is cut off the request path before it is sent upstream
+	StripPrefix string
+	// Rewrite, when set, gets the last word on the path sent upstream
+	// and sees it after StripPrefix was applied
+	Rewrite func(path string) string
+	// Pool, when set, balances requests over several upstreams
+	// and takes the place of Upstream
+	Pool *upstream.Pool
+	// Metrics, when set, records how long upstreams take to answer
+	Metrics *metrics.HTTPMetrics
+}
+
+// NewReverseProxy returns a ReverseProxy for the upstream URL, mounted at
+// prefix, which is stripped from requests before they are forwarded
+func NewReverseProxy(upstream, prefix string) (*ReverseProxy, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("upstream needs a scheme and a host: " + upstream)
+	}
+	return &ReverseProxy{Upstream: u, StripPrefix: prefix}, nil
+}
+
+// ServeRequest is the ReverseProxy as a server.Handler
+func (p *ReverseProxy) ServeRequest(w *response.Writer, req *request.Request) {
+	base := p.Upstream
+	if p.Pool != nil {
+		backend, err := p.Pool.Pick(p.hashKey(req))
+		if err != nil {
+			_ = w.WriteError(server.NewHandlerError(response.StatusServiceUnavailable, ""))
+			return
+		}
+		failed := true
+		defer func() { p.Pool.Done(backend, failed) }()
+
+		failed = p.forward(w, req, backend.URL)
+		return
+	}
+
+	p.forward(w, req, base)
+}
+
+// forward sends req to base and streams the answer back. It reports
+// whether the upstream failed, by being unreachable or answering with a
+// 5xx. A request refused before it goes upstream is not the upstream's
+// failure.
+func (p *ReverseProxy) forward(w *response.Writer, req *request.Request, base *url.URL) (upstreamFailed bool) {
+	outReq, err := p.outgoingRequest(req, base)
+	if err != nil {
+		_ = w.WriteError(server.NewHandlerError(response.StatusBad, err.Error()))
+		return false
+	}
+
+	start := time.Now()
+	resp, err := proxyClient.Do(req.Context(), outReq)
+	if p.Metrics != nil {
+		p.Metrics.UpstreamDuration.Observe(time.Since(start).Seconds(), base.Host)
+	}
+	if err != nil {
+		_ = w.WriteError(upstreamError(err))
+		// a client that went away is not the upstream's fault either
+		return req.Context().Err() == nil
+	}
+	defer resp.Body.Close()
+
+	copyResponse(w, resp)
+	return resp.StatusCode >= 500
+}
+
+// hashKey is what consistent hashing keys on: the configured header,
+// or the client's IP when there is none
+func (p *ReverseProxy) hashKey(req *request.Request) string {
+	if name := p.Pool.HashHeader(); name != "" {
+		if val, _ := req.Headers.Get(name); val != "" {
+			return val
+		}
+	}
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return ip
+}
+
+func (p *ReverseProxy) outgoingRequest(req *request.Request, base *url.URL) (*request.Request, error) {
+	target, err := url.ParseRequestURI(req.RequestLine.RequestTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.TrimPrefix(target.Path, p.StripPrefix)
+	if p.Rewrite != nil {
+		path = p.Rewrite(path)
+	}
+
+	out := *base
+	out.Path = joinPath(base.Path, path)
+	out.RawPath = ""
+	switch {
+	case base.RawQuery == "":
+		out.RawQuery = target.RawQuery
+	case target.RawQuery != "":
+		out.RawQuery = base.RawQuery + "&" + target.RawQuery
+	}
+
+	outReq, err := client.NewRequest(req.RequestLine.Method, out.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := connectionHeaders(req.Headers)
+	// the upstream gets its own Host, the original one goes in X-Forwarded-Host
+	skip["host"] = true
+	for key, val := range req.Headers {
+		if !skip[key] {
+			outReq.Headers.Set(key, val)
+		}
+	}
+	addForwardedHeaders(outReq.Headers, req)
+	return outReq, nil
+}
+
+// addForwardedHeaders tells the upstream who the request is really from,
+// both in the X-Forwarded-* headers and in the standard Forwarded header
+// (RFC 7239), adding to whatever earlier proxies put there
+func addForwardedHeaders(h headers.Headers, req *request.Request) {
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientIP = req.RemoteAddr
+	}
+	host, _ := req.Headers.Get("Host")
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	if clientIP != "" {
+		// Set adds to the chain earlier proxies left behind
+		h.Set("X-Forwarded-For", clientIP)
+	}
+	if host != "" {
+		h["x-forwarded-host"] = host
+	}
+	h["x-forwarded-proto"] = proto
+
+	var element []string
+	if clientIP != "" {
+		forNode := clientIP
+		if strings.Contains(clientIP, ":") {
+			// IPv6 addresses have to be bracketed and quoted
+			forNode = `"[` + clientIP + `]"`
+		}
+		element = append(element, "for="+forNode)
+	}
+	if host != "" {
+		element = append(element, `host="`+host+`"`)
+	}
+	element = append(element, "proto="+proto)
+
+	h.Set("Forwarded", strings.Join(element, ";"))
+}
+
+// copyResponse streams the upstream response back to the client. Bodies of
+// known length keep their Content-Length, anything else is sent chunked,
+// together with the upstream's trailers.
+func copyResponse(w *response.Writer, resp *client.Response) {
+	heads := headers.NewHeaders()
+	skip := connectionHeaders(resp.Headers)
+	for key, val := range resp.Headers {
+		if !skip[key] {
+			heads[key] = val
+		}
+	}
+	heads.Set("Connection", "close")
+
+	declared, _ := resp.Headers.Get("Trailer")
+	chunked := resp.ContentLength < 0 || declared != ""
+	if chunked {
+		_ = heads.Remove("Content-Length")
+		heads.Set("Transfer-Encoding", "chunked")
+		if declared != "" {
+			heads.Set("Trailer", declared)
+		}
+	}
+
+	if err := w.WriteStatusLine(resp.StatusCode); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return
+	}
+
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(chunk)
+		if n > 0 {
+			var werr error
+			if chunked {
+				_, werr = w.WriteChunkedBody(chunk[:n])
+			} else {
+				// flushed right away so slow upstreams still stream through
+				if _, werr = w.WriteBody(chunk[:n]); werr == nil {
+					werr = w.Flush()
+				}
+			}
+			if werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			// a failed read leaves us with a truncated body, all we can
+			// do is end the response early
+			break
+		}
+	}
+
+	if !chunked {
+		return
+	}
+	for key, val := range resp.Trailers {
+		// trailers the upstream did not declare are dropped
+		_ = w.SetTrailer(key, val)
+	}
+	_, _ = w.WriteChunkedBodyDone()
+}
+
+// connectionHeaders returns the hop-by-hop headers of h, both the standard
+// ones and any extra ones named in its Connection header
+func connectionHeaders(h headers.Headers) map[string]bool {
+	skip := map[string]bool{}
+	for _, name := range hopHeaders {
+		skip[name] = true
+	}
+	conn, _ := h.Get("Connection")
+	for _, field := range strings.Split(conn, ",") {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			skip[field] = true
+		}
+	}
+	return skip
+}
+
+// joinPath glues the upstream base path and the request path together
+// with exactly one slash between them
+func joinPath(base, path string) string {
+	if base == "" {
+		if !strings.HasPrefix(path, "/") {
+			return "/" + path
+		}
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// upstreamError picks the status for a failed upstream request:
+// 504 when it timed out, 502 for everything else
+func upstreamError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return server.NewHandlerError(response.StatusGatewayTimeout, "")
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return server.NewHandlerError(response.StatusGatewayTimeout, "")
+	}
+	return server.NewHandlerError(response.StatusBadGateway, "")
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/metrics"
+	"goHttp/internal/upstream"
+)
+
+func TestReverseProxy(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("X-Upstream", "yes")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created "+r.URL.Path)
+		w.Header().Set("X-Checksum", "abc123")
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewReverseProxy(upstream.URL+"/base", "/api")
+	require.NoError(t, err)
+
+	resp := serve(t, proxy.ServeRequest, "POST /api/things?id=7 HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: X-Secret\r\n"+
+		"X-Secret: hop\r\n"+
+		"X-Custom: end-to-end\r\n"+
+		"X-Forwarded-For: 10.0.0.1\r\n"+
+		"\r\n"+
+		"hello")
+	body, _ := io.ReadAll(resp.Body)
+
+	t.Run("request is forwarded", func(t *testing.T) {
+		assert.Equal(t, "POST", got.Method)
+		assert.Equal(t, "/base/things", got.URL.Path)
+		assert.Equal(t, "id=7", got.URL.RawQuery)
+		assert.Equal(t, "hello", gotBody)
+		assert.Equal(t, "end-to-end", got.Header.Get("X-Custom"))
+		assert.Empty(t, got.Header.Get("X-Secret"))
+	})
+
+	t.Run("forwarding headers", func(t *testing.T) {
+		// the test request does not come from a real connection, so there
+		// is no client address to add to the chain
+		assert.Equal(t, "10.0.0.1", got.Header.Get("X-Forwarded-For"))
+		assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+		assert.Equal(t, "http", got.Header.Get("X-Forwarded-Proto"))
+		assert.Equal(t, `host="example.com";proto=http`, got.Header.Get("Forwarded"))
+	})
+
+	t.Run("response is relayed", func(t *testing.T) {
+		assert.Equal(t, 201, resp.StatusCode)
+		assert.Equal(t, "created /base/things", string(body))
+		assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+		assert.Empty(t, resp.Header.Get("Keep-Alive"))
+		assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"))
+	})
+}
+
+func TestReverseProxyUpstreamDown(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	proxy, err := NewReverseProxy(upstream.URL, "")
+	require.NoError(t, err)
+	upstream.Close()
+
+	reg := metrics.NewRegistry()
+	proxy.Metrics = metrics.NewHTTPMetrics(reg)
+
+	resp := serve(t, proxy.ServeRequest, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 502, resp.StatusCode)
+
+	// failed attempts count towards upstream latency too
+	var out strings.Builder
+	_, _ = reg.WriteTo(&out)
+	assert.Contains(t, out.String(), `gohttp_upstream_duration_seconds_count{upstream="`+proxy.Upstream.Host+`"} 1`)
+}
+
+func TestReverseProxyPool(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		}))
+	}
+	a, b := newUpstream("a"), newUpstream("b")
+	defer a.Close()
+	defer b.Close()
+
+	pool, err := upstream.NewPool([]string{a.URL, b.URL}, upstream.PoolOptions{})
+	require.NoError(t, err)
+	defer pool.Close()
+	proxy := &ReverseProxy{Pool: pool}
+
+	var got []string
+	for range 4 {
+		resp := serve(t, proxy.ServeRequest, "GET / HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+		got = append(got, string(body))
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, got)
+	for _, backend := range pool.Backends() {
+		assert.Zero(t, backend.Active())
+	}
+}
+
+func TestReverseProxyPoolBadRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	pool, err := upstream.NewPool([]string{backend.URL}, upstream.PoolOptions{MaxFails: 1})
+	require.NoError(t, err)
+	defer pool.Close()
+	proxy := &ReverseProxy{Pool: pool}
+
+	// the client's fault, not the backend's
+	resp := serve(t, proxy.ServeRequest, "GET nope HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.True(t, pool.Backends()[0].Healthy())
+
+	resp = serve(t, proxy.ServeRequest, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+}
@@ -12,6 +12,9 @@ type Headers map[string]string
 const (
 	colon   = ":"
 	symbols = "!#$%&'*+-.^_`|~"
+
+	// TimeFormat is the IMF-fixdate layout HTTP uses for dates (RFC 9110 section 5.6.7)
+	TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
 )
 
 var (
@@ -0,0 +1,40 @@
+package headers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// QValue is one element of a comma separated list with quality weights,
+// like the ones sent in Accept or Accept-Encoding
+type QValue struct {
+	Value string
+	Q     float64
+}
+
+// ParseQValues splits a header value such as "gzip;q=0.8, br" into its
+// elements. Values are lowercased, a missing or malformed q counts as 1,
+// and any other parameters are dropped.
+func ParseQValues(value string) []QValue {
+	var values []QValue
+	for _, item := range strings.Split(value, ",") {
+		val, params, _ := strings.Cut(item, ";")
+		val = strings.ToLower(strings.TrimSpace(val))
+		if val == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, raw, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			}
+		}
+		values = append(values, QValue{Value: val, Q: q})
+	}
+	return values
+}
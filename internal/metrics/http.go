@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"strconv"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+// HTTPMetrics are the metrics the server and the reverse proxy record
+type HTTPMetrics struct {
+	Registry *Registry
+
+	ConnectionsAccepted *Counter
+	ConnectionsActive   *Gauge
+	// labelled by method, route and status
+	Requests *Counter
+	// labelled by method and route
+	RequestDuration *Histogram
+	RequestSize     *Histogram
+	ResponseSize    *Histogram
+	// labelled by the kind of error
+	ParseErrors *Counter
+	// labelled by upstream host
+	UpstreamDuration *Histogram
+}
+
+// NewHTTPMetrics registers the HTTP metrics on reg, or returns the ones
+// registered there before
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		Registry: reg,
+		ConnectionsAccepted: reg.NewCounter("gohttp_connections_accepted_total",
+			"Connections accepted by the server."),
+		ConnectionsActive: reg.NewGauge("gohttp_connections_active",
+			"Connections currently open."),
+		Requests: reg.NewCounter("gohttp_requests_total",
+			"Requests served, by method, route and status.", "method", "route", "status"),
+		RequestDuration: reg.NewHistogram("gohttp_request_duration_seconds",
+			"Time from reading a request to finishing its response.", DefaultBuckets, "method", "route"),
+		RequestSize: reg.NewHistogram("gohttp_request_size_bytes",
+			"Size of request bodies.", SizeBuckets, "method", "route"),
+		ResponseSize: reg.NewHistogram("gohttp_response_size_bytes",
+			"Size of response bodies as sent.", SizeBuckets, "method", "route"),
+		ParseErrors: reg.NewCounter("gohttp_parse_errors_total",
+			"Requests that could not be parsed, by kind of error.", "error"),
+		UpstreamDuration: reg.NewHistogram("gohttp_upstream_duration_seconds",
+			"Time the reverse proxy waited for upstream response heads.", DefaultBuckets, "upstream"),
+	}
+}
+
+// StatusLabel formats a status code for the status label
+func StatusLabel(code response.StatusCode) string {
+	return strconv.Itoa(int(code))
+}
+
+// Handler serves reg in the text exposition format. It fits server.Handler.
+func Handler(reg *Registry) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		var body bytes.Buffer
+		if _, err := reg.WriteTo(&body); err != nil {
+			_ = w.WriteError(err)
+			return
+		}
+
+		heads := response.GetDefaultHeaders(body.Len())
+		_ = heads.Update("Content-Type", ContentType)
+		heads.Set("Cache-Control", "no-store")
+		if err := w.WriteStatusLine(response.StatusOK); err != nil {
+			return
+		}
+		if err := w.WriteHeaders(heads); err != nil {
+			return
+		}
+		_, _ = w.WriteBody(body.Bytes())
+	}
+}
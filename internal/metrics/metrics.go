@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorMetricExists = fmt.Errorf("metric is already registered as another type or with other labels")
+	ErrorLabelCount   = fmt.Errorf("wrong number of label values")
+)
+
+// DefaultBuckets suit latencies in seconds, from 5ms up to 10s
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets suit body sizes in bytes, from 64B up to 16MB in steps of four
+var SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+// Registry holds metrics and writes them out in the Prometheus text
+// exposition format. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*vec)}
+}
+
+// Counter only ever goes up, like a number of requests served
+type Counter struct {
+	v *vec
+}
+
+// Gauge goes up and down, like a number of open connections
+type Gauge struct {
+	v *vec
+}
+
+// Histogram counts observations, like latencies, in buckets
+type Histogram struct {
+	v *vec
+}
+
+// NewCounter registers a counter with the given label names. Registering
+// a name again returns the metric already there, so independent parts of
+// a program can share one registry; it panics if that metric is of
+// another type or has other labels.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register("counter", name, help, nil, labels)}
+}
+
+// NewGauge registers a gauge, see NewCounter
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register("gauge", name, help, nil, labels)}
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// DefaultBuckets when nil. See NewCounter.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &Histogram{r.register("histogram", name, help, buckets, labels)}
+}
+
+func (r *Registry) register(typ, name, help string, buckets []float64, labels []string) *vec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.metrics[name]; ok {
+		if v.typ != typ || !slices.Equal(v.labels, labels) || !slices.Equal(v.buckets, buckets) {
+			panic(fmt.Errorf("%w: %s", ErrorMetricExists, name))
+		}
+		return v
+	}
+	v := &vec{typ: typ, name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.metrics[name] = v
+	return v
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("counters can not go down")
+	}
+	c.v.update(labelValues, func(s *series) { s.value += v })
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.v.update(labelValues, func(s *series) { s.value += v })
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.v.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Observe records v in the series with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.v.update(labelValues, func(s *series) {
+		// counts are per bucket here and summed up when written
+		i, _ := slices.BinarySearch(h.v.buckets, v)
+		s.counts[i]++
+		s.sum += v
+	})
+}
+
+// vec is a metric along with one series per combination of label values
+type vec struct {
+	typ     string
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// histograms only: observations per bucket, the last one being +Inf
+	counts []uint64
+	sum    float64
+}
+
+func (v *vec) update(labelValues []string, f func(s *series)) {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Errorf("%w for %s: got %d, want %d", ErrorLabelCount, v.name, len(labelValues), len(v.labels)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		if v.typ == "histogram" {
+			s.counts = make([]uint64, len(v.buckets)+1)
+		}
+		v.series[key] = s
+	}
+	f(s)
+}
+
+// ContentType is what the text exposition format is served as
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteTo writes every metric in the text exposition format, sorted by
+// name and then by label values
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	vecs := make([]*vec, 0, len(r.metrics))
+	for _, v := range r.metrics {
+		vecs = append(vecs, v)
+	}
+	r.mu.Unlock()
+	slices.SortFunc(vecs, func(a, b *vec) int { return strings.Compare(a.name, b.name) })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, v := range vecs {
+		v.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	w.WriteString("# HELP " + v.name + " " + escapeHelp(v.help) + "\n")
+	w.WriteString("# TYPE " + v.name + " " + v.typ + "\n")
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		if v.typ != "histogram" {
+			w.WriteString(v.name + v.labelSet(s.labelValues, "") + " " + formatValue(s.value) + "\n")
+			continue
+		}
+
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(v.buckets) {
+				le = v.buckets[i]
+			}
+			w.WriteString(v.name + "_bucket" + v.labelSet(s.labelValues, formatValue(le)) +
+				" " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(v.name + "_sum" + v.labelSet(s.labelValues, "") + " " + formatValue(s.sum) + "\n")
+		w.WriteString(v.name + "_count" + v.labelSet(s.labelValues, "") + " " + strconv.FormatUint(cumulative, 10) + "\n")
+	}
+}
+
+// labelSet formats {name="value",...}, with an le label added for
+// histogram buckets
+func (v *vec) labelSet(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range v.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
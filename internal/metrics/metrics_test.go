@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounter("requests_total", "Requests served.", "method", "code")
+	active := reg.NewGauge("active", "Open connections,\nright now.")
+	latency := reg.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "path")
+
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+	requests.Inc("POST", `5"0\0`)
+	active.Inc()
+	active.Inc()
+	active.Dec()
+	latency.Observe(0.05, "/")
+	latency.Observe(0.1, "/")
+	latency.Observe(3, "/")
+
+	var out strings.Builder
+	n, err := reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.EqualValues(t, out.Len(), n)
+	assert.Equal(t, `# HELP active Open connections,\nright now.
+# TYPE active gauge
+active 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{path="/",le="0.1"} 2
+latency_seconds_bucket{path="/",le="1"} 2
+latency_seconds_bucket{path="/",le="+Inf"} 3
+latency_seconds_sum{path="/"} 3.15
+latency_seconds_count{path="/"} 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3
+requests_total{method="POST",code="5\"0\\0"} 1
+`, out.String())
+}
+
+func TestRegister(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("hits_total", "Hits.", "route")
+
+	t.Run("same metric is shared", func(t *testing.T) {
+		again := reg.NewCounter("hits_total", "Hits.", "route")
+		again.Inc("/")
+		c.Inc("/")
+		var out strings.Builder
+		_, _ = reg.WriteTo(&out)
+		assert.Contains(t, out.String(), `hits_total{route="/"} 2`)
+	})
+
+	t.Run("conflicting metric", func(t *testing.T) {
+		assert.Panics(t, func() { reg.NewGauge("hits_total", "Hits.", "route") })
+		assert.Panics(t, func() { reg.NewCounter("hits_total", "Hits.") })
+	})
+
+	t.Run("misuse", func(t *testing.T) {
+		assert.Panics(t, func() { c.Inc() })
+		assert.Panics(t, func() { c.Add(-1, "/") })
+	})
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// AccessLogFormat picks how AccessLog writes its entries
+type AccessLogFormat int
+
+const (
+	// Apache Common Log Format: host ident user [time] "request" status bytes
+	AccessLogCommon AccessLogFormat = iota
+	// Common Log Format followed by the quoted Referer and User-Agent
+	AccessLogCombined
+	// one JSON object per line
+	AccessLogJSON
+)
+
+// clfTime is the timestamp layout of the Apache log formats
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+type AccessLogOptions struct {
+	Format AccessLogFormat
+	// Output receives one write per entry, os.Stdout when nil. Use a
+	// RotatingFile to log to a file that is rotated by size.
+	Output io.Writer
+}
+
+// AccessEntry is what gets recorded about a request
+type AccessEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	User       string
+	Method     string
+	Target     string
+	Proto      string
+	Status     response.StatusCode
+	Bytes      int64
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+}
+
+// AccessLog returns middleware that writes an entry for every request once
+// its response is complete. It finishes the response itself, so the byte
+// count covers what body filters held back; list it first in Chain so it
+// sees the response the way the client does.
+func AccessLog(opts AccessLogOptions) server.Middleware {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	// entries from concurrent requests must not interleave
+	var mu sync.Mutex
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			if !req.ReceivedAt.IsZero() {
+				start = req.ReceivedAt
+			}
+
+			completed := false
+			defer func() {
+				entry := newAccessEntry(w, req, start)
+				// a panicking handler gets an error page from the server
+				// unless it started responding or took the connection
+				if !completed && entry.Status == 0 && w.HijackedAt().IsZero() {
+					entry.Status = response.StatusInServErr
+				}
+
+				line := entry.Format(opts.Format)
+				mu.Lock()
+				defer mu.Unlock()
+				if _, err := io.WriteString(opts.Output, line); err != nil {
+					w.Logger().Warn("writing access log", "err", err)
+				}
+			}()
+
+			next(w, req)
+			if err := w.Finish(); err != nil {
+				w.Logger().Warn("finishing response", "err", err)
+			}
+			completed = true
+		}
+	}
+}
+
+func newAccessEntry(w *response.Writer, req *request.Request, start time.Time) AccessEntry {
+	entry := AccessEntry{
+		Time:       start,
+		RemoteAddr: req.RemoteAddr,
+		User:       basicAuthUser(req),
+		Method:     req.RequestLine.Method,
+		Target:     req.RequestLine.RequestTarget,
+		Proto:      "HTTP/" + req.RequestLine.HTTPVersion,
+		Status:     w.Status(),
+		Bytes:      w.BytesWritten(),
+		Duration:   time.Since(start),
+	}
+	// a hijacked connection, like a CONNECT tunnel, may stay open for
+	// long after the request was answered
+	if hijacked := w.HijackedAt(); !hijacked.IsZero() {
+		entry.Duration = hijacked.Sub(start)
+	}
+	entry.Referer, _ = req.Headers.Get("Referer")
+	entry.UserAgent, _ = req.Headers.Get("User-Agent")
+	return entry
+}
+
+// basicAuthUser is the user name of Basic credentials, which is what
+// Apache logs as the remote user
+func basicAuthUser(req *request.Request) string {
+	auth, err := req.Headers.Get("Authorization")
+	if err != nil {
+		return ""
+	}
+	scheme, creds, _ := strings.Cut(auth, " ")
+	if !strings.EqualFold(scheme, "Basic") {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(creds))
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(decoded), ":")
+	return user
+}
+
+// Format renders the entry as a single line, newline included
+func (e AccessEntry) Format(format AccessLogFormat) string {
+	if format == AccessLogJSON {
+		return e.formatJSON()
+	}
+
+	host := e.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	// no status is known when the handler sent nothing, or took the
+	// connection and answered on it without recording what it sent
+	status := "-"
+	if e.Status != 0 {
+		status = strconv.Itoa(int(e.Status))
+	}
+
+	var b strings.Builder
+	b.WriteString(orDash(host) + " - " + orDash(escapeLogField(e.User)))
+	b.WriteString(" [" + e.Time.Format(clfTime) + "] ")
+	b.WriteString(`"` + escapeLogField(e.Method+" "+e.Target+" "+e.Proto) + `" `)
+	b.WriteString(status + " " + size)
+	if format == AccessLogCombined {
+		b.WriteString(` "` + orDash(escapeLogField(e.Referer)) + `"`)
+		b.WriteString(` "` + orDash(escapeLogField(e.UserAgent)) + `"`)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func (e AccessEntry) formatJSON() string {
+	line, _ := json.Marshal(struct {
+		Time       string  `json:"time"`
+		RemoteAddr string  `json:"remote_addr"`
+		User       string  `json:"user,omitempty"`
+		Method     string  `json:"method"`
+		Target     string  `json:"target"`
+		Proto      string  `json:"proto"`
+		Status     int     `json:"status,omitempty"`
+		Bytes      int64   `json:"bytes"`
+		DurationMS float64 `json:"duration_ms"`
+		Referer    string  `json:"referer,omitempty"`
+		UserAgent  string  `json:"user_agent,omitempty"`
+	}{
+		Time:       e.Time.Format(time.RFC3339Nano),
+		RemoteAddr: e.RemoteAddr,
+		User:       e.User,
+		Method:     e.Method,
+		Target:     e.Target,
+		Proto:      e.Proto,
+		Status:     int(e.Status),
+		Bytes:      e.Bytes,
+		DurationMS: float64(e.Duration) / float64(time.Millisecond),
+		Referer:    e.Referer,
+		UserAgent:  e.UserAgent,
+	})
+	return string(line) + "\n"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogField escapes quotes, backslashes and control bytes the way
+// Apache does, so a client can not forge entries with a crafted header
+func escapeLogField(s string) string {
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			b.WriteString(`\x`)
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+)
+
+func TestAccessEntryFormat(t *testing.T) {
+	entry := AccessEntry{
+		Time:       time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		RemoteAddr: "127.0.0.1:51234",
+		User:       "frank",
+		Method:     "GET",
+		Target:     "/apache_pb.gif",
+		Proto:      "HTTP/1.0",
+		Status:     200,
+		Bytes:      2326,
+		Duration:   1500 * time.Microsecond,
+		Referer:    "http://www.example.com/start.html",
+		UserAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+	}
+
+	t.Run("common", func(t *testing.T) {
+		assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`+"\n",
+			entry.Format(AccessLogCommon))
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 `+
+			`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`+"\n",
+			entry.Format(AccessLogCombined))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var got map[string]any
+		require.NoError(t, json.Unmarshal([]byte(entry.Format(AccessLogJSON)), &got))
+		assert.Equal(t, "127.0.0.1:51234", got["remote_addr"])
+		assert.Equal(t, "/apache_pb.gif", got["target"])
+		assert.EqualValues(t, 200, got["status"])
+		assert.EqualValues(t, 2326, got["bytes"])
+		assert.EqualValues(t, 1.5, got["duration_ms"])
+		assert.Equal(t, "Mozilla/4.08 [en] (Win98; I ;Nav)", got["user_agent"])
+	})
+
+	t.Run("empty and hostile fields", func(t *testing.T) {
+		e := entry
+		e.User, e.Bytes, e.Referer = "", 0, ""
+		e.UserAgent = "evil\"\n127.0.0.1 - - fake"
+		assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 - `+
+			`"-" "evil\"\x0a127.0.0.1 - - fake"`+"\n",
+			e.Format(AccessLogCombined))
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		e := entry
+		e.Status = 0
+		assert.Contains(t, e.Format(AccessLogCommon), `HTTP/1.0" - 2326`)
+		assert.NotContains(t, e.Format(AccessLogJSON), `"status"`)
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	logged := AccessLog(AccessLogOptions{Format: AccessLogJSON, Output: &out})
+	entry := func(t *testing.T) map[string]any {
+		t.Helper()
+		var got map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		out.Reset()
+		return got
+	}
+
+	t.Run("request", func(t *testing.T) {
+		h := logged(htmlHandler("<p>hello</p>", "text/html"))
+		servetest.Serve(t, h, "GET /page?x=1 HTTP/1.1\r\nHost: localhost\r\nReferer: /start\r\n"+
+			"User-Agent: test/1.0\r\nAuthorization: Basic ZnJhbms6c2VjcmV0\r\n\r\n")
+
+		got := entry(t)
+		assert.Equal(t, "GET", got["method"])
+		assert.Equal(t, "/page?x=1", got["target"])
+		assert.Equal(t, "HTTP/1.1", got["proto"])
+		assert.Equal(t, "frank", got["user"])
+		assert.EqualValues(t, 200, got["status"])
+		assert.EqualValues(t, len("<p>hello</p>"), got["bytes"])
+		assert.Equal(t, "/start", got["referer"])
+		assert.Equal(t, "test/1.0", got["user_agent"])
+	})
+
+	t.Run("counts encoded bytes", func(t *testing.T) {
+		body := strings.Repeat("compress me ", 200)
+		h := server.Chain(htmlHandler(body, "text/html"), logged, Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+		encoded, _ := io.ReadAll(resp.Body)
+
+		got := entry(t)
+		assert.EqualValues(t, len(encoded), got["bytes"])
+		assert.Less(t, len(encoded), len(body))
+	})
+
+	t.Run("panicking handler", func(t *testing.T) {
+		h := logged(func(w *response.Writer, req *request.Request) { panic("boom") })
+		assert.Panics(t, func() {
+			req, err := request.RequestFromReader(strings.NewReader("GET /boom HTTP/1.1\r\n\r\n"))
+			require.NoError(t, err)
+			h(response.NewWriter(io.Discard), req)
+		})
+		assert.EqualValues(t, 500, entry(t)["status"])
+	})
+
+	t.Run("tunnel", func(t *testing.T) {
+		h := logged(func(w *response.Writer, req *request.Request) {
+			conn, _, err := w.Hijack()
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = w.RecordHijackedStatus(response.StatusOK)
+			// the tunnel stays open long after the request was answered
+			time.Sleep(50 * time.Millisecond)
+		})
+		req, err := request.RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		server, client := net.Pipe()
+		defer client.Close()
+		w := response.NewWriter(server)
+		w.SetHijacker(func() (net.Conn, []byte, error) { return server, nil, nil })
+		h(w, req)
+
+		got := entry(t)
+		assert.EqualValues(t, 200, got["status"])
+		assert.Less(t, got["duration_ms"], 50.0)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	// only two backups are kept
+	assert.NoFileExists(t, path+".3")
+
+	require.NoError(t, f.Close())
+	_, err = f.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, ErrorRotatingFileClosed)
+}
+
+func TestRotatingFileFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(path, 10, 1)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// a directory with something in it can not be removed to make room
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "keep"), 0o755))
+
+	_, err = f.Write([]byte("first\n"))
+	require.NoError(t, err)
+	n, err := f.Write([]byte("second\n"))
+	assert.Error(t, err)
+	assert.Equal(t, 7, n)
+
+	// the log keeps growing in place until rotating works again
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(b))
+
+	require.NoError(t, os.RemoveAll(path+".1"))
+	_, err = f.Write([]byte("third\n"))
+	require.NoError(t, err)
+	b, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(b))
+}
@@ -0,0 +1,788 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goHttp/internal/client"
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+type CacheOptions struct {
+	// MaxBytes is the memory budget for stored responses, headers and
+	// bodies together. The least recently used ones are dropped when it
+	// runs out. 64 MiB when zero.
+	MaxBytes int64
+	// MaxEntryBytes is the largest response that gets stored,
+	// MaxBytes / 8 when zero
+	MaxEntryBytes int64
+}
+
+// Cache returns middleware that keeps GET responses in memory the way a
+// shared cache does (RFC 9111). It goes in front of handlers whose
+// responses are expensive to make, like a ReverseProxy.
+//
+// Fresh responses are served without calling the handler, with an Age
+// header added. Stale ones are revalidated by calling the handler with a
+// conditional request, and a 304 from it refreshes the stored response.
+// Responses that allow stale-while-revalidate are served stale while the
+// revalidation runs in the background.
+func Cache(opts CacheOptions) server.Middleware {
+	return newCache(opts).middleware
+}
+
+type cache struct {
+	opts CacheOptions
+	now  func() time.Time
+
+	mu sync.Mutex
+	// most recently used entry in front
+	lru *list.List
+	// the variants stored under each cache key
+	entries map[string][]*list.Element
+	size    int64
+	// entries with a background revalidation running
+	revalidating map[*cacheEntry]bool
+	background   sync.WaitGroup
+}
+
+// cacheEntry is one stored response. Entries are never changed once
+// stored, a refreshed response takes the place of the old one.
+type cacheEntry struct {
+	key     string
+	status  response.StatusCode
+	headers headers.Headers
+	body    []byte
+	cc      cacheControl
+	// the values of the request headers named in Vary
+	vary map[string]string
+
+	// the response varies on something other than request headers
+	varyAll bool
+	// the body came out shorter than its Content-Length
+	truncated bool
+
+	date         time.Time
+	ageValue     time.Duration
+	requestTime  time.Time
+	responseTime time.Time
+	size         int64
+}
+
+func newCache(opts CacheOptions) *cache {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 64 << 20
+	}
+	if opts.MaxEntryBytes <= 0 {
+		opts.MaxEntryBytes = opts.MaxBytes / 8
+	}
+	return &cache{
+		opts:         opts,
+		now:          time.Now,
+		lru:          list.New(),
+		entries:      map[string][]*list.Element{},
+		revalidating: map[*cacheEntry]bool{},
+	}
+}
+
+func (c *cache) middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		key := cacheKey(req)
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			next(w, req)
+			// a successful unsafe request changed the resource, so what
+			// is stored for it is outdated (RFC 9111 section 4.4)
+			if !safeMethod(method) && w.Status() >= 200 && w.Status() < 400 {
+				c.invalidate(key)
+			}
+			return
+		}
+
+		reqCC := requestCacheControl(req)
+		if reqCC.has("no-store") {
+			next(w, req)
+			return
+		}
+
+		entry := c.lookup(key, req)
+		if entry == nil {
+			if reqCC.has("only-if-cached") {
+				_ = w.WriteError(server.NewHandlerError(response.StatusGatewayTimeout, "not in cache"))
+				return
+			}
+			c.fetch(w, req, key, next)
+			return
+		}
+
+		age := entry.age(c.now())
+		lifetime := entry.lifetime()
+		if entry.fresh(reqCC, age, lifetime) {
+			c.serve(w, req, entry, age)
+			return
+		}
+
+		if swr, ok := entry.cc.seconds("stale-while-revalidate"); ok && age < lifetime+swr &&
+			!reqCC.has("no-cache") && !entry.mustRevalidate() {
+			c.revalidateInBackground(entry, req, next)
+			c.serve(w, req, entry, age)
+			return
+		}
+		if reqCC.has("only-if-cached") {
+			_ = w.WriteError(server.NewHandlerError(response.StatusGatewayTimeout, "not in cache"))
+			return
+		}
+		c.revalidate(w, req, entry, next)
+	}
+}
+
+// fetch handles a cache miss: the response streams to the client as usual
+// and a copy of it is stored on the way
+func (c *cache) fetch(w *response.Writer, req *request.Request, key string, next server.Handler) {
+	if req.RequestLine.Method != "GET" {
+		next(w, req)
+		return
+	}
+
+	requestTime := c.now()
+	addFilter(w, func(status response.StatusCode, h headers.Headers, wire io.Writer) io.WriteCloser {
+		// filters that ran before this one sit between the recorder and the
+		// wire, so their changes to h do not go with the recorded bytes
+		seen := maps.Clone(h)
+		return &cacheRecorder{
+			next: wire,
+			max:  c.opts.MaxEntryBytes,
+			done: func(body []byte) {
+				// filters added later may still change the headers,
+				// so they are only looked at once the body is done
+				stored := recordedHeaders(w.Headers(), seen, h)
+				c.store(c.newEntry(key, req, status, stored, body, requestTime), req)
+			},
+		}
+	})
+	next(w, req)
+}
+
+// revalidate asks the handler whether the stale entry is still good,
+// and answers the client with whatever turns out to be current
+func (c *cache) revalidate(w *response.Writer, req *request.Request, entry *cacheEntry, next server.Handler) {
+	if !entry.hasValidators() {
+		c.fetch(w, req, entry.key, next)
+		return
+	}
+
+	requestTime := c.now()
+	run := startHandler(next, conditionalRequest(req, entry))
+	resp, err := client.ResponseFromReader(run.reader, "GET")
+	if err != nil {
+		run.wait()
+		_ = w.WriteError(server.NewHandlerError(response.StatusBadGateway, err.Error()))
+		return
+	}
+	defer run.wait()
+
+	if resp.StatusCode == response.StatusNotModified {
+		fresh := c.refresh(entry, req, resp, requestTime)
+		c.serve(w, req, fresh, fresh.age(c.now()))
+		return
+	}
+	c.relay(w, req, c.recorder(entry.key, req, resp, requestTime), resp)
+}
+
+func (c *cache) revalidateInBackground(entry *cacheEntry, req *request.Request, next server.Handler) {
+	c.mu.Lock()
+	if c.revalidating[entry] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[entry] = true
+	c.mu.Unlock()
+
+	// the client's request is gone once it is answered, so work on a copy
+	// that keeps its context values but not its cancellation
+	condReq := conditionalRequest(req.WithContext(context.WithoutCancel(req.Context())), entry)
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, entry)
+			c.mu.Unlock()
+		}()
+		// nobody is waiting on this request to catch a panic
+		defer func() { _ = recover() }()
+
+		requestTime := c.now()
+		run := startHandler(next, condReq)
+		defer run.wait()
+		resp, err := client.ResponseFromReader(run.reader, "GET")
+		if err != nil {
+			return
+		}
+		if resp.StatusCode == response.StatusNotModified {
+			c.refresh(entry, condReq, resp, requestTime)
+			return
+		}
+		// nobody reads the body past what can be stored, closing the
+		// pipe stops the handler instead
+		rec := c.recorder(entry.key, condReq, resp, requestTime)
+		if _, err := io.Copy(rec, io.LimitReader(resp.Body, rec.max+1)); err == nil {
+			_ = rec.Close()
+		}
+	}()
+}
+
+// refresh updates the stored entry with the headers sent along with a 304
+// (RFC 9111 section 4.3.4) and returns the entry to serve
+func (c *cache) refresh(entry *cacheEntry, req *request.Request, resp *client.Response, requestTime time.Time) *cacheEntry {
+	h := maps.Clone(entry.headers)
+	for key, val := range resp.Headers {
+		if key != "content-length" && !isHopByHop(key) {
+			h[key] = val
+		}
+	}
+	fresh := c.newEntry(entry.key, req, entry.status, h, entry.body, requestTime)
+	fresh.vary = entry.vary
+	c.store(fresh, req)
+	return fresh
+}
+
+// recorder returns a cacheRecorder that stores resp, the answer to req,
+// once its whole body went through it
+func (c *cache) recorder(key string, req *request.Request, resp *client.Response, requestTime time.Time) *cacheRecorder {
+	return &cacheRecorder{
+		next: io.Discard,
+		max:  c.opts.MaxEntryBytes,
+		done: func(body []byte) {
+			c.store(c.newEntry(key, req, resp.StatusCode, resp.Headers, body, requestTime), req)
+		},
+	}
+}
+
+// relay streams a response of the handler on to the client, with its body
+// going through rec on the way
+func (c *cache) relay(w *response.Writer, req *request.Request, rec *cacheRecorder, resp *client.Response) {
+	body := io.TeeReader(resp.Body, rec)
+	h := headers.NewHeaders()
+	for key, val := range resp.Headers {
+		if !isHopByHop(key) {
+			h[key] = val
+		}
+	}
+
+	etag, _ := h.Get("ETag")
+	lastModified, _ := parseHTTPDate(h["last-modified"])
+	if pre := req.EvaluatePreconditions(etag, lastModified); pre != request.PreconditionPass {
+		// the client gets no body, the cache still takes it
+		if _, err := io.Copy(io.Discard, io.LimitReader(body, rec.max+1)); err == nil {
+			_ = rec.Close()
+		}
+		if pre == request.PreconditionNotModified {
+			_ = w.WriteNotModified(h)
+		} else {
+			_ = w.WriteError(server.NewHandlerError(response.StatusPreconditionFailed, ""))
+		}
+		return
+	}
+
+	write := w.WriteBody
+	if resp.ContentLength < 0 {
+		delete(h, "content-length")
+		h["transfer-encoding"] = "chunked"
+		write = w.WriteChunkedBody
+	}
+	if err := w.WriteStatusLine(resp.StatusCode); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return
+	}
+
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(chunk)
+		if n > 0 {
+			if _, werr := write(chunk[:n]); werr != nil {
+				return
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a truncated body is neither stored nor finished properly
+			return
+		}
+	}
+	_ = rec.Close()
+	if resp.ContentLength < 0 {
+		_, _ = w.WriteChunkedBodyDone()
+	}
+}
+
+// serve answers the request from entry
+func (c *cache) serve(w *response.Writer, req *request.Request, entry *cacheEntry, age time.Duration) {
+	h := maps.Clone(entry.headers)
+	h["age"] = strconv.Itoa(int(age / time.Second))
+
+	etag, _ := h.Get("ETag")
+	lastModified, _ := parseHTTPDate(h["last-modified"])
+	switch req.EvaluatePreconditions(etag, lastModified) {
+	case request.PreconditionNotModified:
+		_ = w.WriteNotModified(h)
+		return
+	case request.PreconditionFailed:
+		_ = w.WriteError(server.NewHandlerError(response.StatusPreconditionFailed, ""))
+		return
+	}
+
+	if err := w.WriteStatusLine(entry.status); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return
+	}
+	_, _ = w.WriteBody(entry.body)
+}
+
+// newEntry turns a response to req into an entry. Whether it may be
+// stored is up to storable.
+func (c *cache) newEntry(key string, req *request.Request, status response.StatusCode, h headers.Headers, body []byte, requestTime time.Time) *cacheEntry {
+	stored := headers.NewHeaders()
+	for key, val := range h {
+		if !isHopByHop(key) {
+			stored[key] = val
+		}
+	}
+	stored["content-length"] = strconv.Itoa(len(body))
+	responseTime := c.now()
+	if _, ok := stored["date"]; !ok {
+		stored["date"] = response.FormatDate(responseTime)
+	}
+
+	e := &cacheEntry{
+		key:          key,
+		status:       status,
+		headers:      stored,
+		body:         body,
+		cc:           parseCacheControl(h["cache-control"]),
+		vary:         map[string]string{},
+		requestTime:  requestTime,
+		responseTime: responseTime,
+	}
+	if cl, err := strconv.Atoi(h["content-length"]); err == nil && cl != len(body) {
+		e.truncated = true
+	}
+	for _, name := range strings.Split(h["vary"], ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			e.varyAll = true
+		} else if name != "" {
+			e.vary[name], _ = req.Headers.Get(name)
+		}
+	}
+	e.date, _ = parseHTTPDate(stored["date"])
+	if age, err := strconv.Atoi(stored["age"]); err == nil && age > 0 {
+		e.ageValue = time.Duration(age) * time.Second
+	}
+	delete(stored, "age")
+
+	for key, val := range stored {
+		e.size += int64(len(key) + len(val))
+	}
+	e.size += int64(len(body))
+	return e
+}
+
+// storable reports whether a shared cache may keep the response to req
+// (RFC 9111 section 3)
+func (e *cacheEntry) storable(req *request.Request) bool {
+	if e.cc.has("no-store") || e.cc.has("private") || !cacheableStatus(e.status, e.cc, e.headers) {
+		return false
+	}
+	// one user's authorized response must not be handed to another
+	if auth, _ := req.Headers.Get("Authorization"); auth != "" &&
+		!e.cc.has("public") && !e.cc.has("s-maxage") && !e.cc.has("must-revalidate") {
+		return false
+	}
+	// a cut short body would be served cut short again, and Vary: *
+	// depends on things outside the request that can not be matched later
+	if e.truncated || e.varyAll {
+		return false
+	}
+	// stale from the start with no way to revalidate it
+	return e.lifetime() > 0 || e.hasValidators()
+}
+
+func (c *cache) lookup(key string, req *request.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.entries[key] {
+		entry := elem.Value.(*cacheEntry)
+		if entry.matches(req) {
+			c.lru.MoveToFront(elem)
+			return entry
+		}
+	}
+	return nil
+}
+
+func (c *cache) store(entry *cacheEntry, req *request.Request) {
+	if entry.size > c.opts.MaxEntryBytes || !entry.storable(req) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a response for the same variant takes the place of the old one
+	variants := c.entries[entry.key]
+	for i, elem := range variants {
+		if maps.Equal(elem.Value.(*cacheEntry).vary, entry.vary) {
+			c.removeLocked(elem)
+			variants = append(variants[:i:i], variants[i+1:]...)
+			break
+		}
+	}
+	c.entries[entry.key] = append(variants, c.lru.PushFront(entry))
+	c.size += entry.size
+
+	for c.size > c.opts.MaxBytes {
+		oldest := c.lru.Back()
+		c.removeLocked(oldest)
+		key := oldest.Value.(*cacheEntry).key
+		c.entries[key] = deleteElement(c.entries[key], oldest)
+	}
+}
+
+func (c *cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.entries[key] {
+		c.removeLocked(elem)
+	}
+	delete(c.entries, key)
+}
+
+// removeLocked takes elem off the LRU list, the caller fixes up entries
+func (c *cache) removeLocked(elem *list.Element) {
+	c.lru.Remove(elem)
+	c.size -= elem.Value.(*cacheEntry).size
+}
+
+func deleteElement(elems []*list.Element, elem *list.Element) []*list.Element {
+	for i, e := range elems {
+		if e == elem {
+			return append(elems[:i:i], elems[i+1:]...)
+		}
+	}
+	return elems
+}
+
+// matches reports whether the entry was stored for a request that had
+// the same values in the headers the response varies on
+func (e *cacheEntry) matches(req *request.Request) bool {
+	for name, want := range e.vary {
+		if got, _ := req.Headers.Get(name); got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// age is how old the response is by now (RFC 9111 section 4.2.3)
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparent := max(e.responseTime.Sub(e.date), 0)
+	corrected := e.ageValue + e.responseTime.Sub(e.requestTime)
+	return max(apparent, corrected) + now.Sub(e.responseTime)
+}
+
+// lifetime is how long the response stays fresh (RFC 9111 section 4.2.1)
+func (e *cacheEntry) lifetime() time.Duration {
+	if e.cc.has("no-cache") {
+		return 0
+	}
+	if d, ok := e.cc.seconds("s-maxage"); ok {
+		return d
+	}
+	if d, ok := e.cc.seconds("max-age"); ok {
+		return d
+	}
+	if raw, ok := e.headers["expires"]; ok {
+		// an invalid Expires means already expired
+		expires, err := parseHTTPDate(raw)
+		if err != nil {
+			return 0
+		}
+		return max(expires.Sub(e.date), 0)
+	}
+
+	// without explicit freshness, a tenth of the time since the last
+	// change is a common guess (RFC 9111 section 4.2.2)
+	if lastModified, err := parseHTTPDate(e.headers["last-modified"]); err == nil && cacheableByDefault(e.status) {
+		return min(max(e.date.Sub(lastModified), 0)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// fresh reports whether the entry may be served without asking the
+// handler, given the constraints of the request
+func (e *cacheEntry) fresh(reqCC cacheControl, age, lifetime time.Duration) bool {
+	if reqCC.has("no-cache") {
+		return false
+	}
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && lifetime-age < minFresh {
+		return false
+	}
+	if age < lifetime {
+		return true
+	}
+	if e.mustRevalidate() {
+		return false
+	}
+	// max-stale without a value takes a response of any age
+	if val, ok := reqCC["max-stale"]; ok {
+		maxStale, limited := reqCC.seconds("max-stale")
+		return val == "" || (limited && age < lifetime+maxStale)
+	}
+	return false
+}
+
+func (e *cacheEntry) mustRevalidate() bool {
+	return e.cc.has("must-revalidate") || e.cc.has("proxy-revalidate") || e.cc.has("no-cache")
+}
+
+func (e *cacheEntry) hasValidators() bool {
+	return e.headers["etag"] != "" || e.headers["last-modified"] != ""
+}
+
+// conditionalRequest is a copy of req that asks whether entry is still
+// current. It keeps req's context, so the request ID and trace go along and
+// the handler stops when the client does. The client's own conditions are
+// left out, they are checked against whatever the cache ends up serving.
+func conditionalRequest(req *request.Request, entry *cacheEntry) *request.Request {
+	out := req.WithContext(req.Context())
+	out.RequestLine.Method = "GET"
+	out.Body = nil
+	out.Headers = headers.NewHeaders()
+	for key, val := range req.Headers {
+		switch key {
+		case "if-match", "if-none-match", "if-modified-since", "if-unmodified-since", "if-range":
+		default:
+			out.Headers[key] = val
+		}
+	}
+	if etag := entry.headers["etag"]; etag != "" {
+		out.Headers["if-none-match"] = etag
+	}
+	if lastModified := entry.headers["last-modified"]; lastModified != "" {
+		out.Headers["if-modified-since"] = lastModified
+	}
+	return out
+}
+
+// handlerRun is a handler running in its own goroutine, without a client
+// on the other end. What it writes is read back from reader as it comes.
+type handlerRun struct {
+	reader   *io.PipeReader
+	done     chan struct{}
+	panicked any
+}
+
+func startHandler(h server.Handler, req *request.Request) *handlerRun {
+	pr, pw := io.Pipe()
+	run := &handlerRun{reader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(run.done)
+		defer func() {
+			if v := recover(); v != nil {
+				run.panicked = v
+				pw.CloseWithError(fmt.Errorf("handler panicked: %v", v))
+			}
+		}()
+
+		w := response.NewWriter(pw)
+		h(w, req)
+		err := w.Finish()
+		if err == nil && w.Status() == 0 {
+			err = fmt.Errorf("handler wrote no response")
+		}
+		pw.CloseWithError(err)
+	}()
+	return run
+}
+
+// wait stops reading, which makes the handler's writes fail if it is not
+// done yet, and waits for it to return. A panic in the handler is passed
+// on to the caller.
+func (r *handlerRun) wait() {
+	r.reader.Close()
+	<-r.done
+	if r.panicked != nil {
+		panic(r.panicked)
+	}
+}
+
+// recordedHeaders are the headers that go with the bytes a cacheRecorder
+// saw: the handler's, with the changes made by filters between the handler
+// and the recorder. Those are the ones between seen, what the recorder's
+// filter got, and final, what went out.
+func recordedHeaders(handler, seen, final headers.Headers) headers.Headers {
+	h := maps.Clone(handler)
+	for key, val := range final {
+		if old, ok := seen[key]; !ok || old != val {
+			h[key] = val
+		}
+	}
+	for key := range seen {
+		if _, ok := final[key]; !ok {
+			delete(h, key)
+		}
+	}
+	return h
+}
+
+// cacheRecorder passes the body on and keeps a copy of it, unless it
+// grows past max
+type cacheRecorder struct {
+	next    io.Writer
+	buf     bytes.Buffer
+	max     int64
+	tooBig  bool
+	failed  bool
+	done    func(body []byte)
+	written int64
+}
+
+func (r *cacheRecorder) Write(p []byte) (int, error) {
+	n, err := r.next.Write(p)
+	if err != nil {
+		r.failed = true
+	}
+	r.written += int64(n)
+	if !r.tooBig {
+		if r.written > r.max {
+			r.tooBig = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (r *cacheRecorder) Close() error {
+	if !r.tooBig && !r.failed {
+		r.done(r.buf.Bytes())
+	}
+	return nil
+}
+
+func cacheKey(req *request.Request) string {
+	host, _ := req.Headers.Get("Host")
+	return host + " " + req.RequestLine.RequestTarget
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// cacheableByDefault lists the statuses that may be stored and get a
+// heuristic lifetime without explicit freshness (RFC 9110 section 15.1)
+func cacheableByDefault(status response.StatusCode) bool {
+	switch status {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+func cacheableStatus(status response.StatusCode, cc cacheControl, h headers.Headers) bool {
+	if cacheableByDefault(status) {
+		return true
+	}
+	// partial content would need range-aware storage
+	if status < 200 || status == response.StatusPartialContent || status == response.StatusNotModified {
+		return false
+	}
+	_, expires := h["expires"]
+	return expires || cc.has("max-age") || cc.has("s-maxage") || cc.has("public")
+}
+
+func isHopByHop(key string) bool {
+	switch key {
+	case "connection", "keep-alive", "proxy-connection", "te", "trailer", "transfer-encoding", "upgrade":
+		return true
+	}
+	return false
+}
+
+func parseHTTPDate(raw string) (time.Time, error) {
+	return time.Parse(headers.TimeFormat, strings.TrimSpace(raw))
+}
+
+// cacheControl holds Cache-Control directives, by lowercase name, with
+// their argument if they have one
+type cacheControl map[string]string
+
+func parseCacheControl(raw string) cacheControl {
+	cc := cacheControl{}
+	for _, directive := range strings.Split(raw, ",") {
+		name, val, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			cc[name] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return cc
+}
+
+// requestCacheControl also honors the Pragma: no-cache of HTTP/1.0
+// clients when there is no Cache-Control
+func requestCacheControl(req *request.Request) cacheControl {
+	raw, _ := req.Headers.Get("Cache-Control")
+	if raw == "" {
+		if pragma, _ := req.Headers.Get("Pragma"); strings.Contains(strings.ToLower(pragma), "no-cache") {
+			raw = "no-cache"
+		}
+	}
+	return parseCacheControl(raw)
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the delta-seconds argument of a directive
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	val, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
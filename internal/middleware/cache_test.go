@@ -0,0 +1,393 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// origin is a handler that counts its calls, dates its responses with
+// the fake clock and answers If-None-Match with a 304
+type origin struct {
+	mu      sync.Mutex
+	calls   int
+	clock   *fakeClock
+	cc      string
+	version string
+	extra   map[string]string
+	// the conditional header of the last request
+	ifNoneMatch string
+}
+
+func (o *origin) handle(w *response.Writer, req *request.Request) {
+	o.mu.Lock()
+	o.calls++
+	o.ifNoneMatch, _ = req.Headers.Get("If-None-Match")
+	version, cc := o.version, o.cc
+	o.mu.Unlock()
+
+	path := req.Path()
+	body := path + " " + version
+	heads := response.GetDefaultHeaders(len(body))
+	heads.Set("Date", response.FormatDate(o.clock.Now()))
+	heads.Set("ETag", `"`+version+`"`)
+	if cc != "" {
+		heads.Set("Cache-Control", cc)
+	}
+	for key, val := range o.extra {
+		heads.Set(key, val)
+	}
+
+	if inm, _ := req.Headers.Get("If-None-Match"); inm == `"`+version+`"` {
+		_ = w.WriteNotModified(heads)
+		return
+	}
+	server.WriteResponse(w, response.StatusOK, heads, body)
+}
+
+func (o *origin) Calls() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls
+}
+
+func newCacheTest(opts CacheOptions, cc string) (*cache, *origin, server.Handler) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	o := &origin{clock: clock, cc: cc, version: "v1"}
+	c := newCache(opts)
+	c.now = clock.Now
+	return c, o, c.middleware(o.handle)
+}
+
+func get(t *testing.T, h server.Handler, path string, extra ...string) (int, string, map[string]string) {
+	t.Helper()
+	raw := "GET " + path + " HTTP/1.1\r\nHost: example.com\r\n" + strings.Join(extra, "") + "\r\n"
+	resp := servetest.Serve(t, h, raw)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	heads := map[string]string{}
+	for key := range resp.Header {
+		heads[strings.ToLower(key)] = resp.Header.Get(key)
+	}
+	return resp.StatusCode, string(body), heads
+}
+
+func TestCacheFreshness(t *testing.T) {
+	t.Run("fresh responses come from the cache", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+
+		status, body, heads := get(t, h, "/a")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "/a v1", body)
+		assert.Empty(t, heads["age"])
+
+		o.clock.Advance(5 * time.Second)
+		status, body, heads = get(t, h, "/a")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "/a v1", body)
+		assert.Equal(t, "5", heads["age"])
+		assert.Equal(t, `"v1"`, heads["etag"])
+		assert.Equal(t, 1, o.Calls())
+
+		// other targets are cached on their own
+		_, body, _ = get(t, h, "/b")
+		assert.Equal(t, "/b v1", body)
+		assert.Equal(t, 2, o.Calls())
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "")
+		o.extra = map[string]string{"Expires": response.FormatDate(o.clock.Now().Add(time.Minute))}
+
+		get(t, h, "/a")
+		o.clock.Advance(30 * time.Second)
+		get(t, h, "/a")
+		assert.Equal(t, 1, o.Calls())
+	})
+
+	t.Run("responses that may not be stored", func(t *testing.T) {
+		for _, cc := range []string{"no-store", "private, max-age=60", "no-cache"} {
+			_, o, h := newCacheTest(CacheOptions{}, cc)
+			get(t, h, "/a")
+			get(t, h, "/a")
+			assert.Equal(t, 2, o.Calls(), cc)
+		}
+	})
+
+	t.Run("request directives", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+		get(t, h, "/a")
+
+		o.clock.Advance(10 * time.Second)
+		get(t, h, "/a", "Cache-Control: max-age=5\r\n")
+		assert.Equal(t, 2, o.Calls())
+
+		get(t, h, "/a", "Pragma: no-cache\r\n")
+		assert.Equal(t, 3, o.Calls())
+
+		get(t, h, "/a", "Cache-Control: no-store\r\n")
+		assert.Equal(t, 4, o.Calls())
+
+		status, _, _ := get(t, h, "/missing", "Cache-Control: only-if-cached\r\n")
+		assert.Equal(t, 504, status)
+		assert.Equal(t, 4, o.Calls())
+	})
+
+	t.Run("client conditionals are answered from the cache", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+		get(t, h, "/a")
+
+		status, body, _ := get(t, h, "/a", "If-None-Match: \"v1\"\r\n")
+		assert.Equal(t, 304, status)
+		assert.Empty(t, body)
+		assert.Equal(t, 1, o.Calls())
+	})
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	t.Run("stale entries are revalidated", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+		get(t, h, "/a")
+
+		o.clock.Advance(90 * time.Second)
+		status, body, heads := get(t, h, "/a")
+		assert.Equal(t, 2, o.Calls())
+		assert.Equal(t, `"v1"`, o.ifNoneMatch)
+		// the 304 refreshed the stored response
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "/a v1", body)
+		assert.Equal(t, "0", heads["age"])
+
+		get(t, h, "/a")
+		assert.Equal(t, 2, o.Calls())
+	})
+
+	t.Run("revalidation keeps the request's context", func(t *testing.T) {
+		type key struct{}
+		c, o, _ := newCacheTest(CacheOptions{}, "max-age=60")
+		var seen any
+		h := c.middleware(func(w *response.Writer, req *request.Request) {
+			seen = req.Context().Value(key{})
+			o.handle(w, req)
+		})
+		tagged := func(w *response.Writer, req *request.Request) {
+			h(w, req.WithContext(context.WithValue(req.Context(), key{}, "tagged")))
+		}
+		get(t, tagged, "/a")
+		seen = nil
+
+		o.clock.Advance(90 * time.Second)
+		get(t, tagged, "/a")
+		assert.Equal(t, 2, o.Calls())
+		assert.Equal(t, "tagged", seen)
+	})
+
+	t.Run("a changed resource replaces the entry", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+		get(t, h, "/a")
+
+		o.clock.Advance(90 * time.Second)
+		o.version = "v2"
+		_, body, _ := get(t, h, "/a")
+		assert.Equal(t, "/a v2", body)
+		_, body, _ = get(t, h, "/a")
+		assert.Equal(t, "/a v2", body)
+		assert.Equal(t, 2, o.Calls())
+	})
+
+	t.Run("a changed resource too large to store streams through", func(t *testing.T) {
+		c, o, h := newCacheTest(CacheOptions{MaxEntryBytes: 300}, "max-age=60")
+		get(t, h, "/a")
+
+		o.clock.Advance(90 * time.Second)
+		o.version = strings.Repeat("v", 1000)
+		_, body, _ := get(t, h, "/a")
+		assert.Equal(t, "/a "+o.version, body)
+
+		// only the stale entry is left, so the handler is asked again
+		_, body, _ = get(t, h, "/a")
+		assert.Equal(t, "/a "+o.version, body)
+		assert.Equal(t, 3, o.Calls())
+		assert.Less(t, c.size, int64(300))
+	})
+
+	t.Run("a changed chunked response is relayed and stored", func(t *testing.T) {
+		c, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+		get(t, h, "/a")
+
+		o.clock.Advance(90 * time.Second)
+		chunked := c.middleware(func(w *response.Writer, req *request.Request) {
+			o.mu.Lock()
+			o.calls++
+			o.mu.Unlock()
+			heads := response.GetDefaultHeaders(0)
+			_ = heads.Remove("Content-Length")
+			heads.Set("Transfer-Encoding", "chunked")
+			heads.Set("Cache-Control", "max-age=60")
+			heads.Set("ETag", `"v2"`)
+			_ = w.WriteStatusLine(response.StatusOK)
+			_ = w.WriteHeaders(heads)
+			_, _ = w.WriteChunkedBody([]byte("/a "))
+			_, _ = w.WriteChunkedBody([]byte("v2"))
+			_, _ = w.WriteChunkedBodyDone()
+		})
+		_, body, _ := get(t, chunked, "/a")
+		assert.Equal(t, "/a v2", body)
+
+		_, body, heads := get(t, h, "/a")
+		assert.Equal(t, "/a v2", body)
+		assert.Equal(t, "5", heads["content-length"])
+		assert.Equal(t, 2, o.Calls())
+	})
+
+	t.Run("stale-while-revalidate", func(t *testing.T) {
+		c, o, h := newCacheTest(CacheOptions{}, "max-age=10, stale-while-revalidate=60")
+		get(t, h, "/a")
+
+		o.clock.Advance(30 * time.Second)
+		o.mu.Lock()
+		o.version = "v2"
+		o.mu.Unlock()
+		// served stale right away, while the handler is asked in the background
+		_, body, heads := get(t, h, "/a")
+		assert.Equal(t, "/a v1", body)
+		assert.Equal(t, "30", heads["age"])
+
+		c.background.Wait()
+		assert.Equal(t, 2, o.Calls())
+		_, body, _ = get(t, h, "/a")
+		assert.Equal(t, "/a v2", body)
+		assert.Equal(t, 2, o.Calls())
+
+		// past the window the client waits for the revalidation
+		o.clock.Advance(2 * time.Minute)
+		get(t, h, "/a")
+		assert.Equal(t, 3, o.Calls())
+	})
+
+	t.Run("unsafe methods invalidate", func(t *testing.T) {
+		_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+		get(t, h, "/a")
+		servetest.Serve(t, h, "POST /a HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n")
+		assert.Equal(t, 2, o.Calls())
+
+		get(t, h, "/a")
+		assert.Equal(t, 3, o.Calls())
+	})
+}
+
+func TestCacheVary(t *testing.T) {
+	_, o, h := newCacheTest(CacheOptions{}, "max-age=60")
+	o.extra = map[string]string{"Vary": "Accept-Language"}
+
+	get(t, h, "/a", "Accept-Language: en\r\n")
+	get(t, h, "/a", "Accept-Language: de\r\n")
+	assert.Equal(t, 2, o.Calls())
+
+	get(t, h, "/a", "Accept-Language: en\r\n")
+	get(t, h, "/a", "Accept-Language: de\r\n")
+	assert.Equal(t, 2, o.Calls())
+
+	o.extra = map[string]string{"Vary": "*"}
+	get(t, h, "/star")
+	get(t, h, "/star")
+	assert.Equal(t, 4, o.Calls())
+}
+
+func TestCacheEviction(t *testing.T) {
+	// room for about two entries
+	c, o, h := newCacheTest(CacheOptions{MaxBytes: 300, MaxEntryBytes: 300}, "max-age=60")
+
+	get(t, h, "/a")
+	get(t, h, "/b")
+	get(t, h, "/a")
+	get(t, h, "/c")
+	assert.Equal(t, 3, o.Calls())
+	assert.LessOrEqual(t, c.size, int64(300))
+
+	// /b was used least recently and made room for /c
+	get(t, h, "/a")
+	assert.Equal(t, 3, o.Calls())
+	get(t, h, "/b")
+	assert.Equal(t, 4, o.Calls())
+}
+
+func TestCacheWithCompress(t *testing.T) {
+	gzipGet := func(t *testing.T, h server.Handler) (string, map[string]string) {
+		t.Helper()
+		_, body, heads := get(t, h, "/a", "Accept-Encoding: gzip\r\n")
+		if heads["content-encoding"] != "gzip" {
+			return body, heads
+		}
+		gz, err := gzip.NewReader(strings.NewReader(body))
+		require.NoError(t, err)
+		plain, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		return string(plain), heads
+	}
+
+	t.Run("compressing in front of the cache", func(t *testing.T) {
+		c, o, _ := newCacheTest(CacheOptions{}, "max-age=60")
+		h := server.Chain(o.handle, Compress(CompressOptions{}), c.middleware)
+
+		for range 2 {
+			body, heads := gzipGet(t, h)
+			assert.Equal(t, "gzip", heads["content-encoding"])
+			assert.Equal(t, "/a v1", body)
+		}
+		assert.Equal(t, 1, o.Calls())
+
+		// the plain bytes were stored, so clients without gzip get them too
+		_, body, heads := get(t, h, "/a")
+		assert.Empty(t, heads["content-encoding"])
+		assert.Equal(t, "/a v1", body)
+		assert.Equal(t, 1, o.Calls())
+	})
+
+	t.Run("compressing behind the cache", func(t *testing.T) {
+		c, o, _ := newCacheTest(CacheOptions{}, "max-age=60")
+		h := server.Chain(o.handle, c.middleware, Compress(CompressOptions{}))
+
+		for range 2 {
+			body, heads := gzipGet(t, h)
+			assert.Equal(t, "gzip", heads["content-encoding"])
+			assert.Equal(t, "/a v1", body)
+		}
+		assert.Equal(t, 1, o.Calls())
+
+		// the compressed bytes were stored, they vary on Accept-Encoding
+		_, body, heads := get(t, h, "/a")
+		assert.Empty(t, heads["content-encoding"])
+		assert.Equal(t, "/a v1", body)
+		assert.Equal(t, 2, o.Calls())
+	})
+}
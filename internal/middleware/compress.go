@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// DefaultSkipTypes are content types that are already compressed, so running
+// them through gzip again only burns CPU. Entries ending in "/" match every
+// subtype.
+var DefaultSkipTypes = []string{
+	"video/",
+	"audio/",
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+}
+
+var ErrorCompressionLevel = fmt.Errorf("invalid compression level")
+
+type CompressOptions struct {
+	// MinSize is the smallest Content-Length worth compressing. Responses that
+	// do not announce a length are always compressed.
+	MinSize int
+	// Level is handed to gzip/zlib as is, zero picks the default level.
+	// It has to lie between gzip.HuffmanOnly and gzip.BestCompression.
+	Level int
+	// SkipTypes overrides DefaultSkipTypes when non-nil
+	SkipTypes []string
+}
+
+// Compress returns middleware that gzip or deflate encodes response bodies
+// based on the client's Accept-Encoding. Compressed responses drop their
+// Content-Length and are sent chunked instead.
+//
+// It panics with ErrorCompressionLevel when opts.Level is out of range, so
+// the mistake shows at startup rather than on the first request.
+func Compress(opts CompressOptions) server.Middleware {
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if opts.Level < gzip.HuffmanOnly || opts.Level > gzip.BestCompression {
+		panic(fmt.Errorf("%w: %d", ErrorCompressionLevel, opts.Level))
+	}
+	if opts.SkipTypes == nil {
+		opts.SkipTypes = DefaultSkipTypes
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			accept, _ := req.Headers.Get("Accept-Encoding")
+			coding := negotiateEncoding(accept)
+
+			// registered even when the client takes no coding we support,
+			// so the response still carries Vary
+			addFilter(w, compressFilter(coding, opts))
+			next(w, req)
+		}
+	}
+}
+
+// addFilter adds f to w. Middleware listed after one that already started
+// the response can not filter it anymore, so the request goes through
+// without f and the mistake is logged.
+func addFilter(w *response.Writer, f response.BodyFilter) {
+	if err := w.AddBodyFilter(f); err != nil {
+		w.Logger().Warn("response started before middleware could filter it", "err", err)
+	}
+}
+
+func compressFilter(coding string, opts CompressOptions) response.BodyFilter {
+	return func(status response.StatusCode, h headers.Headers, next io.Writer) io.WriteCloser {
+		// these never have a body worth compressing, and the byte offsets
+		// of a partial response refer to the uncompressed content
+		if status < 200 || status == 204 || status == 304 || status == response.StatusPartialContent {
+			return nil
+		}
+		if enc, _ := h.Get("Content-Encoding"); enc != "" {
+			return nil
+		}
+		if ct, _ := h.Get("Content-Type"); skipType(ct, opts.SkipTypes) {
+			return nil
+		}
+
+		// the body now depends on Accept-Encoding, whether we end up
+		// compressing this particular response or not
+		h.Set("Vary", "Accept-Encoding")
+
+		if cl, _ := h.Get("Content-Length"); cl != "" {
+			size, err := strconv.Atoi(cl)
+			if err == nil && size < opts.MinSize {
+				return nil
+			}
+		}
+		if coding == "" {
+			return nil
+		}
+
+		// length of the compressed body is not known up front
+		_ = h.Remove("Content-Length")
+		if te, _ := h.Get("Transfer-Encoding"); !strings.Contains(strings.ToLower(te), "chunked") {
+			h.Set("Transfer-Encoding", "chunked")
+		}
+		h.Set("Content-Encoding", coding)
+		// the compressed bytes differ from what a strong tag vouches for
+		if etag, _ := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			_ = h.Update("ETag", "W/"+etag)
+		}
+
+		// the level was checked by Compress, so neither of these fails
+		if coding == "gzip" {
+			wc, _ := gzip.NewWriterLevel(next, opts.Level)
+			return wc
+		}
+		// the "deflate" coding is zlib framed (RFC 9110 section 8.4.1.2)
+		wc, _ := zlib.NewWriterLevel(next, opts.Level)
+		return wc
+	}
+}
+
+// skipType reports whether contentType matches one of the types in skip
+func skipType(contentType string, skip []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	for _, s := range skip {
+		if strings.HasSuffix(s, "/") && strings.HasPrefix(mediaType, s) {
+			return true
+		}
+		if mediaType == s {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding value, going
+// by q-values and preferring gzip on a tie. An empty string means the client
+// should get the body as is.
+func negotiateEncoding(accept string) string {
+	if accept == "" {
+		return ""
+	}
+
+	qvalues := map[string]float64{}
+	for _, qv := range headers.ParseQValues(accept) {
+		// x-gzip is an alias kept around for old clients
+		if qv.Value == "x-gzip" {
+			qv.Value = "gzip"
+		}
+		qvalues[qv.Value] = qv.Q
+	}
+
+	lookup := func(coding string) float64 {
+		if q, ok := qvalues[coding]; ok {
+			return q
+		}
+		if q, ok := qvalues["*"]; ok {
+			return q
+		}
+		return 0
+	}
+
+	gzipQ, deflateQ := lookup("gzip"), lookup("deflate")
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	default:
+		return ""
+	}
+}
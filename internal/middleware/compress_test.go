@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+)
+
+func htmlHandler(body string, contentType string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		heads := response.GetDefaultHeaders(len(body))
+		_ = heads.Update("Content-Type", contentType)
+		server.WriteResponse(w, response.StatusOK, heads, body)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                           "",
+		"gzip":                       "gzip",
+		"deflate":                    "deflate",
+		"gzip, deflate, br":          "gzip",
+		"deflate;q=1.0, gzip;q=0.5":  "deflate",
+		"gzip;q=0, deflate":          "deflate",
+		"*":                          "gzip",
+		"*;q=0.1, gzip;q=0":          "deflate",
+		"identity":                   "",
+		"br, zstd":                   "",
+		"x-gzip":                     "gzip",
+		"GZIP;Q=0.8 , deflate;q=0.9": "deflate",
+	}
+	for accept, want := range cases {
+		assert.Equal(t, want, negotiateEncoding(accept), "Accept-Encoding: %q", accept)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("<p>compress me please</p>\n", 100)
+
+	t.Run("gzip", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/html"), Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip, deflate\r\n\r\n")
+
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		assert.Empty(t, resp.Header.Get("Content-Length"))
+
+		gz, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		got, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(got))
+	})
+
+	t.Run("deflate", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/html"), Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: deflate\r\n\r\n")
+
+		assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+		zr, err := zlib.NewReader(resp.Body)
+		require.NoError(t, err)
+		got, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(got))
+	})
+
+	t.Run("client without gzip still gets Vary", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/html"), Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\n\r\n")
+
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		got, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, body, string(got))
+	})
+
+	t.Run("already compressed type is skipped", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "video/mp4"), Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Empty(t, resp.Header.Get("Vary"))
+		assert.Equal(t, int64(len(body)), resp.ContentLength)
+	})
+
+	t.Run("body below minimum size is skipped", func(t *testing.T) {
+		h := server.Chain(htmlHandler("tiny", "text/html"), Compress(CompressOptions{MinSize: 1024}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, int64(4), resp.ContentLength)
+	})
+
+	t.Run("response already started", func(t *testing.T) {
+		// something in front of Compress wrote the head before it ran
+		started := func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				require.NoError(t, w.WriteStatusLine(response.StatusOK))
+				require.NoError(t, w.WriteHeaders(response.GetDefaultHeaders(len(body))))
+				next(w, req)
+			}
+		}
+		h := server.Chain(func(w *response.Writer, req *request.Request) {
+			_, _ = w.WriteBody([]byte(body))
+		}, started, Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		got, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, body, string(got))
+	})
+	t.Run("invalid level", func(t *testing.T) {
+		for _, level := range []int{-3, 10, 100} {
+			assert.PanicsWithError(t, fmt.Sprintf("%s: %d", ErrorCompressionLevel, level), func() {
+				Compress(CompressOptions{Level: level})
+			})
+		}
+		assert.NotPanics(t, func() { Compress(CompressOptions{Level: gzip.HuffmanOnly}) })
+		assert.NotPanics(t, func() { Compress(CompressOptions{Level: gzip.BestCompression}) })
+	})
+}
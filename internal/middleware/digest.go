@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// digestAlgorithms are the RFC 9530 algorithms we can compute, strongest first
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-512": sha512.New,
+	"sha-256": sha256.New,
+}
+
+type DigestOptions struct {
+	// Algorithms are used when the client does not ask for one with
+	// Want-Content-Digest or Want-Repr-Digest. Supported are "sha-256" and
+	// "sha-512", the default is sha-256.
+	Algorithms []string
+	// Repr also sends Repr-Digest, except for partial responses where the
+	// content is only a piece of the representation
+	Repr bool
+}
+
+// Digest returns middleware that sends RFC 9530 Content-Digest (and
+// optionally Repr-Digest) trailers. The digest is computed while the body
+// streams out, so responses are sent chunked. List it before Compress in
+// Chain so the digest covers the encoded bytes that go on the wire.
+func Digest(opts DigestOptions) server.Middleware {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{"sha-256"}
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.RequestLine.Method == "HEAD" {
+				next(w, req)
+				return
+			}
+
+			want, _ := req.Headers.Get("Want-Content-Digest")
+			content := negotiateDigest(want, opts.Algorithms)
+			var repr []string
+			if wantRepr, _ := req.Headers.Get("Want-Repr-Digest"); opts.Repr || wantRepr != "" {
+				repr = negotiateDigest(wantRepr, opts.Algorithms)
+			}
+
+			addFilter(w, digestFilter(w, content, repr))
+			next(w, req)
+		}
+	}
+}
+
+func digestFilter(w *response.Writer, content, repr []string) response.BodyFilter {
+	return func(status response.StatusCode, h headers.Headers, next io.Writer) io.WriteCloser {
+		if status < 200 || status == 204 || status == 304 || len(content) == 0 {
+			return nil
+		}
+		repr := repr
+		if status == response.StatusPartialContent {
+			repr = nil
+		}
+
+		h.Set("Trailer", "Content-Digest")
+		if len(repr) > 0 {
+			h.Set("Trailer", "Repr-Digest")
+		}
+
+		d := &digestWriter{w: w, next: next, content: content, repr: repr, hashes: map[string]hash.Hash{}}
+		for _, alg := range slices.Concat(content, repr) {
+			if _, ok := d.hashes[alg]; !ok {
+				d.hashes[alg] = digestAlgorithms[alg]()
+			}
+		}
+		return d
+	}
+}
+
+// digestWriter hashes the body on its way to next. Content and
+// representation digests hash the same bytes, so they share hashes.
+type digestWriter struct {
+	w       *response.Writer
+	next    io.Writer
+	content []string
+	repr    []string
+	hashes  map[string]hash.Hash
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	n, err := d.next.Write(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	return n, err
+}
+
+func (d *digestWriter) Close() error {
+	if err := d.w.SetTrailer("Content-Digest", d.field(d.content)); err != nil {
+		return err
+	}
+	if len(d.repr) > 0 {
+		return d.w.SetTrailer("Repr-Digest", d.field(d.repr))
+	}
+	return nil
+}
+
+// field formats the digests as a structured field dictionary of byte
+// sequences, e.g. sha-256=:base64:
+func (d *digestWriter) field(algs []string) string {
+	parts := make([]string, 0, len(algs))
+	for _, alg := range algs {
+		sum := base64.StdEncoding.EncodeToString(d.hashes[alg].Sum(nil))
+		parts = append(parts, alg+"=:"+sum+":")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// negotiateDigest picks the algorithm a Want-*-Digest value prefers, such
+// as "sha-256=3, sha-512=10". Preferences run from 1 to 10, 0 means not
+// acceptable. Without a usable preference the defaults are used.
+func negotiateDigest(want string, defaults []string) []string {
+	best, bestWeight := "", 0
+	for _, member := range strings.Split(want, ",") {
+		alg, weight, _ := strings.Cut(strings.TrimSpace(member), "=")
+		alg = strings.ToLower(strings.TrimSpace(alg))
+		if _, ok := digestAlgorithms[alg]; !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || n <= 0 || n > 10 {
+			continue
+		}
+		// stronger algorithm wins a tie
+		if n > bestWeight || (n == bestWeight && alg == "sha-512") {
+			best, bestWeight = alg, n
+		}
+	}
+	if best != "" {
+		return []string{best}
+	}
+
+	algs := make([]string, 0, len(defaults))
+	for _, alg := range defaults {
+		if _, ok := digestAlgorithms[strings.ToLower(alg)]; ok {
+			algs = append(algs, strings.ToLower(alg))
+		}
+	}
+	return algs
+}
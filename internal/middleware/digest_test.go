@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+)
+
+func sha256Field(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func TestNegotiateDigest(t *testing.T) {
+	defaults := []string{"sha-256"}
+	cases := map[string][]string{
+		"":                      {"sha-256"},
+		"sha-512=3":             {"sha-512"},
+		"sha-256=10, sha-512=3": {"sha-256"},
+		"sha-256=5, sha-512=5":  {"sha-512"},
+		"sha-512=0":             {"sha-256"},
+		"md5=10, SHA-512=1":     {"sha-512"},
+		"sha-512=11":            {"sha-256"},
+	}
+	for want, algs := range cases {
+		assert.Equal(t, algs, negotiateDigest(want, defaults), want)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	body := "hello digest"
+
+	t.Run("Content-Digest trailer", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/plain"), Digest(DigestOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\n\r\n")
+		got, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, body, string(got))
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		assert.Equal(t, sha256Field([]byte(body)), resp.Trailer.Get("Content-Digest"))
+		assert.Empty(t, resp.Trailer.Get("Repr-Digest"))
+	})
+
+	t.Run("client preferences", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/plain"), Digest(DigestOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nWant-Content-Digest: sha-512=9, sha-256=1\r\nWant-Repr-Digest: sha-256=1\r\n\r\n")
+		_, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		sum := sha512.Sum512([]byte(body))
+		assert.Equal(t, "sha-512=:"+base64.StdEncoding.EncodeToString(sum[:])+":", resp.Trailer.Get("Content-Digest"))
+		assert.Equal(t, sha256Field([]byte(body)), resp.Trailer.Get("Repr-Digest"))
+	})
+
+	t.Run("covers the encoded content", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/plain"),
+			Digest(DigestOptions{Repr: true}), Compress(CompressOptions{}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+		compressed, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, sha256Field(compressed), resp.Trailer.Get("Content-Digest"))
+		assert.Equal(t, sha256Field(compressed), resp.Trailer.Get("Repr-Digest"))
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		plain, _ := io.ReadAll(zr)
+		assert.Equal(t, body, string(plain))
+	})
+
+	t.Run("partial content has no Repr-Digest", func(t *testing.T) {
+		partial := func(w *response.Writer, req *request.Request) {
+			heads := response.GetDefaultHeaders(5)
+			heads.Set("Content-Range", "bytes 0-4/12")
+			server.WriteResponse(w, response.StatusPartialContent, heads, "hello")
+		}
+		h := server.Chain(partial, Digest(DigestOptions{Repr: true}))
+		resp := servetest.Serve(t, h, "GET / HTTP/1.1\r\n\r\n")
+		_, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, sha256Field([]byte("hello")), resp.Trailer.Get("Content-Digest"))
+		assert.Empty(t, resp.Trailer.Get("Repr-Digest"))
+	})
+
+	t.Run("responses without a body are left alone", func(t *testing.T) {
+		h := server.Chain(htmlHandler(body, "text/plain"), Digest(DigestOptions{}))
+		resp := servetest.Serve(t, h, "HEAD / HTTP/1.1\r\n\r\n")
+		assert.Empty(t, resp.Header.Get("Trailer"))
+		assert.Equal(t, int64(len(body)), resp.ContentLength)
+	})
+}
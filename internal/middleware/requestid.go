@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+// maxRequestIDLength keeps clients from stuffing logs through the header
+const maxRequestIDLength = 128
+
+type RequestIDOptions struct {
+	// Generate makes ids for requests that come without a usable one,
+	// NewRequestID when nil
+	Generate func() string
+}
+
+// RequestID returns middleware that tags every request with an id: the
+// one in its X-Request-ID header when that is valid, a new one otherwise.
+// The id goes in the request's context, where request.Request.ID finds it
+// and client.Do forwards it upstream, in the response's X-Request-ID
+// header and in every line the request's logger writes.
+func RequestID(opts RequestIDOptions) server.Middleware {
+	if opts.Generate == nil {
+		opts.Generate = NewRequestID
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id, _ := req.Headers.Get(request.IDHeader)
+			if !ValidRequestID(id) {
+				if id != "" {
+					w.Logger().Debug("replacing invalid request id", "received", id)
+				}
+				id = opts.Generate()
+			}
+
+			// a filter sets the header on whatever response goes out,
+			// error pages and proxied responses included
+			addFilter(w, func(status response.StatusCode, h headers.Headers, next io.Writer) io.WriteCloser {
+				h[strings.ToLower(request.IDHeader)] = id
+				return nil
+			})
+			w.SetLogger(w.Logger().With("request_id", id))
+			next(w, req.WithContext(request.ContextWithID(req.Context(), id)))
+		}
+	}
+}
+
+// ValidRequestID accepts ids of up to 128 letters, digits and the
+// punctuation UUIDs and common id schemes use
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-_.:+/=@", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random version 4 UUID
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
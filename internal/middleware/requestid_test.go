@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/client"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+)
+
+func TestRequestID(t *testing.T) {
+	var upstreamID string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get("X-Request-ID")
+	}))
+	defer upstream.Close()
+
+	var seen string
+	h := RequestID(RequestIDOptions{})(func(w *response.Writer, req *request.Request) {
+		seen = req.ID()
+		w.Logger().Info("handling")
+		resp, err := client.Get(req.Context(), upstream.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		server.WriteResponse(w, response.StatusOK, response.GetDefaultHeaders(0), "")
+	})
+
+	// run serves raw with a writer logging into logs
+	var logs bytes.Buffer
+	run := func(t *testing.T, h server.Handler, raw string) *http.Response {
+		logs.Reset()
+		return servetest.Serve(t, h, raw, func(w *response.Writer, req *request.Request) {
+			w.SetLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+		})
+	}
+	loggedID := func(t *testing.T) string {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal(logs.Bytes(), &rec))
+		id, _ := rec["request_id"].(string)
+		return id
+	}
+
+	t.Run("incoming id is kept", func(t *testing.T) {
+		resp := run(t, h, "GET / HTTP/1.1\r\nX-Request-ID: abc-123\r\n\r\n")
+		assert.Equal(t, "abc-123", seen)
+		assert.Equal(t, "abc-123", resp.Header.Get("X-Request-ID"))
+		assert.Equal(t, "abc-123", upstreamID)
+		assert.Equal(t, "abc-123", loggedID(t))
+	})
+
+	t.Run("missing or invalid id is replaced", func(t *testing.T) {
+		for _, raw := range []string{
+			"GET / HTTP/1.1\r\n\r\n",
+			"GET / HTTP/1.1\r\nX-Request-ID: two words\r\n\r\n",
+			"GET / HTTP/1.1\r\nX-Request-ID: " + strings.Repeat("a", 129) + "\r\n\r\n",
+		} {
+			resp := run(t, h, raw)
+			assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, seen)
+			assert.Equal(t, seen, resp.Header.Get("X-Request-ID"))
+			// the rejected id does not reach the upstream either
+			assert.Equal(t, seen, upstreamID)
+		}
+	})
+
+	t.Run("error responses carry the id", func(t *testing.T) {
+		failing := RequestID(RequestIDOptions{Generate: func() string { return "fixed" }})(
+			func(w *response.Writer, req *request.Request) {
+				_ = w.WriteError(server.NewHandlerError(response.StatusNotFound, ""))
+			})
+		resp := run(t, failing, "GET / HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 404, resp.StatusCode)
+		assert.Equal(t, "fixed", resp.Header.Get("X-Request-ID"))
+		_, _ = io.Copy(io.Discard, resp.Body)
+	})
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/tracing"
+)
+
+// Trace returns middleware that puts every request in a server span,
+// continuing the trace of an incoming traceparent header. The span rides
+// along in the request's context, so requests the handler sends with
+// client.Do become child spans and carry the trace to the upstream. Like
+// AccessLog it finishes the response, so list it first in Chain.
+func Trace(t *tracing.Tracer) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			remote := tracing.Extract(req.Headers)
+			ctx, span := t.Start(req.Context(), req.RequestLine.Method+" "+req.Path(), tracing.KindServer, remote)
+			span.SetAttribute("http.request.method", req.RequestLine.Method)
+			span.SetAttribute("url.path", req.Path())
+			span.SetAttribute("network.protocol.version", req.RequestLine.HTTPVersion)
+			if req.RemoteAddr != "" {
+				span.SetAttribute("client.address", req.RemoteAddr)
+			}
+			if agent, err := req.Headers.Get("User-Agent"); err == nil {
+				span.SetAttribute("user_agent.original", agent)
+			}
+
+			sc := span.Context()
+			w.SetLogger(w.Logger().With("trace_id", sc.TraceID.String(), "span_id", sc.SpanID.String()))
+
+			completed := false
+			defer func() {
+				status := w.Status()
+				switch {
+				case !completed:
+					span.SetError(fmt.Errorf("handler panicked"))
+					if status == 0 {
+						// the server answers with a 500 then
+						status = response.StatusInServErr
+					}
+				case status >= 500:
+					span.SetError(fmt.Errorf("responded with %d", status))
+				}
+				span.SetAttribute("http.response.status_code", int(status))
+				span.SetAttribute("http.response.body.size", w.BytesWritten())
+				span.End()
+			}()
+
+			next(w, req.WithContext(ctx))
+			if err := w.Finish(); err != nil {
+				span.SetError(err)
+			}
+			completed = true
+		}
+	}
+}
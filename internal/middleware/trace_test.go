@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/client"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+	"goHttp/internal/servetest"
+	"goHttp/internal/tracing"
+)
+
+func TestTrace(t *testing.T) {
+	var gotParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotParent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	var out bytes.Buffer
+	tracer := tracing.NewTracer("proxy", tracing.NewJSONExporter(&out))
+	h := Trace(tracer)(func(w *response.Writer, req *request.Request) {
+		resp, err := client.Get(req.Context(), upstream.URL+"/slow")
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		server.WriteResponse(w, response.StatusOK, response.GetDefaultHeaders(2), "ok")
+	})
+
+	servetest.Serve(t, h, "GET /hop HTTP/1.1\r\nTraceparent: 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01\r\n\r\n")
+
+	var spans []tracing.SpanData
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var span tracing.SpanData
+		require.NoError(t, json.Unmarshal([]byte(line), &span))
+		spans = append(spans, span)
+	}
+	require.Len(t, spans, 2)
+	clientSpan, serverSpan := spans[0], spans[1]
+
+	t.Run("server span continues the caller's trace", func(t *testing.T) {
+		assert.Equal(t, "GET /hop", serverSpan.Name)
+		assert.Equal(t, tracing.KindServer, serverSpan.Kind)
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", serverSpan.TraceID)
+		assert.Equal(t, "b7ad6b7169203331", serverSpan.ParentID)
+		assert.EqualValues(t, 200, serverSpan.Attributes["http.response.status_code"])
+		assert.Equal(t, "ok", serverSpan.Status)
+	})
+
+	t.Run("client span is propagated upstream", func(t *testing.T) {
+		assert.Equal(t, tracing.KindClient, clientSpan.Kind)
+		assert.Equal(t, serverSpan.TraceID, clientSpan.TraceID)
+		assert.Equal(t, serverSpan.SpanID, clientSpan.ParentID)
+		assert.Equal(t, "00-"+clientSpan.TraceID+"-"+clientSpan.SpanID+"-01", gotParent)
+		assert.Equal(t, "error", clientSpan.Status)
+		assert.EqualValues(t, 503, clientSpan.Attributes["http.response.status_code"])
+	})
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"strings"
+	"time"
+
+	"goHttp/internal/headers"
+)
+
+// Precondition is the outcome of evaluating a request's conditional headers
+type Precondition int
+
+const (
+	// PreconditionPass means the request should be handled as usual
+	PreconditionPass Precondition = iota
+	// PreconditionNotModified means the client's copy is current and it
+	// should get a 304 Not Modified
+	PreconditionNotModified
+	// PreconditionFailed means the request should get a 412 Precondition Failed
+	PreconditionFailed
+)
+
+// EvaluatePreconditions checks If-Match, If-Unmodified-Since, If-None-Match
+// and If-Modified-Since against the current etag and lastModified of the
+// target resource, in the order RFC 9110 section 13.2.2 lays out. Pass an
+// empty etag or a zero lastModified when the resource does not have one.
+func (r *Request) EvaluatePreconditions(etag string, lastModified time.Time) Precondition {
+	// dates in headers only go down to the second
+	lastModified = lastModified.Truncate(time.Second)
+	method := r.RequestLine.Method
+
+	if ifMatch, _ := r.Headers.Get("If-Match"); ifMatch != "" {
+		if !matchETag(ifMatch, etag, false) {
+			return PreconditionFailed
+		}
+	} else if since, ok := r.headerDate("If-Unmodified-Since"); ok && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return PreconditionFailed
+		}
+	}
+
+	getOrHead := method == "GET" || method == "HEAD"
+	if ifNoneMatch, _ := r.Headers.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, etag, true) {
+			if getOrHead {
+				return PreconditionNotModified
+			}
+			return PreconditionFailed
+		}
+	} else if since, ok := r.headerDate("If-Modified-Since"); ok && getOrHead && !lastModified.IsZero() {
+		if !lastModified.After(since) {
+			return PreconditionNotModified
+		}
+	}
+
+	return PreconditionPass
+}
+
+func (r *Request) headerDate(name string) (time.Time, bool) {
+	val, _ := r.Headers.Get(name)
+	if val == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(headers.TimeFormat, val)
+	if err != nil {
+		// an invalid date is treated as if the header was never sent
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// matchETag reports whether the If-Match/If-None-Match style list matches
+// etag. weak selects the weak comparison, where only the opaque part of the
+// tags has to be equal, instead of the strong one (RFC 9110 section 8.8.3.2).
+func matchETag(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range splitETags(list) {
+		candidateWeak := strings.HasPrefix(candidate, "W/")
+		etagWeak := strings.HasPrefix(etag, "W/")
+		if !weak && (candidateWeak || etagWeak) {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitETags splits a comma separated list of entity tags. Commas may appear
+// inside the quotes of a tag, so a plain strings.Split will not do.
+func splitETags(list string) []string {
+	var tags []string
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return tags
+		}
+
+		start := 0
+		if strings.HasPrefix(list, "W/") {
+			start = 2
+		}
+		if len(list) <= start || list[start] != '"' {
+			// not an entity tag, skip to the next comma
+			_, rest, _ := strings.Cut(list, ",")
+			list = rest
+			continue
+		}
+
+		end := strings.IndexByte(list[start+1:], '"')
+		if end == -1 {
+			return tags
+		}
+		end += start + 2
+		tags = append(tags, list[:end])
+		list = list[end:]
+	}
+}
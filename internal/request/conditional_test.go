@@ -0,0 +1,58 @@
+package request
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluatePreconditions(t *testing.T) {
+	lastModified := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	const (
+		before = "Thu, 29 Feb 2024 12:00:00 GMT"
+		same   = "Fri, 01 Mar 2024 12:00:00 GMT"
+		after  = "Sat, 02 Mar 2024 12:00:00 GMT"
+	)
+
+	cases := []struct {
+		name    string
+		method  string
+		headers string
+		etag    string
+		want    Precondition
+	}{
+		{"no conditions", "GET", "", `"a"`, PreconditionPass},
+		{"If-None-Match hit", "GET", `If-None-Match: "x", "a"`, `"a"`, PreconditionNotModified},
+		{"If-None-Match weak hit", "GET", `If-None-Match: W/"a"`, `"a"`, PreconditionNotModified},
+		{"If-None-Match miss", "GET", `If-None-Match: "b"`, `"a"`, PreconditionPass},
+		{"If-None-Match star", "HEAD", `If-None-Match: *`, `"a"`, PreconditionNotModified},
+		{"If-None-Match on PUT", "PUT", `If-None-Match: *`, `"a"`, PreconditionFailed},
+		{"If-Match hit", "PUT", `If-Match: "a"`, `"a"`, PreconditionPass},
+		{"If-Match miss", "PUT", `If-Match: "b"`, `"a"`, PreconditionFailed},
+		{"If-Match is strong only", "GET", `If-Match: W/"a"`, `W/"a"`, PreconditionFailed},
+		{"If-Match tag with comma", "GET", `If-Match: "x,y", "a"`, `"a"`, PreconditionPass},
+		{"If-Modified-Since not modified", "GET", "If-Modified-Since: " + same, `"a"`, PreconditionNotModified},
+		{"If-Modified-Since modified", "GET", "If-Modified-Since: " + before, `"a"`, PreconditionPass},
+		{"If-Modified-Since ignored on POST", "POST", "If-Modified-Since: " + after, `"a"`, PreconditionPass},
+		{"If-Modified-Since invalid date", "GET", "If-Modified-Since: yesterday", `"a"`, PreconditionPass},
+		{"If-None-Match wins over If-Modified-Since", "GET", "If-None-Match: \"b\"\r\nIf-Modified-Since: " + after, `"a"`, PreconditionPass},
+		{"If-Unmodified-Since passes", "PUT", "If-Unmodified-Since: " + same, `"a"`, PreconditionPass},
+		{"If-Unmodified-Since fails", "PUT", "If-Unmodified-Since: " + before, `"a"`, PreconditionFailed},
+		{"If-Match wins over If-Unmodified-Since", "PUT", "If-Match: \"a\"\r\nIf-Unmodified-Since: " + before, `"a"`, PreconditionPass},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			raw := c.method + " / HTTP/1.1\r\n"
+			if c.headers != "" {
+				raw += c.headers + "\r\n"
+			}
+			req, err := RequestFromReader(strings.NewReader(raw + "\r\n"))
+			require.NoError(t, err)
+			assert.Equal(t, c.want, req.EvaluatePreconditions(c.etag, lastModified))
+		})
+	}
+}
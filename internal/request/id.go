@@ -0,0 +1,25 @@
+package request
+
+import "context"
+
+// IDHeader carries the id that ties together the log lines one request
+// leaves in every server it passes through
+const IDHeader = "X-Request-ID"
+
+type idKey struct{}
+
+// ContextWithID returns a copy of ctx carrying the request id
+func ContextWithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// IDFromContext returns the request id in ctx, or "" if there is none
+func IDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// ID returns the id the RequestID middleware gave the request
+func (r *Request) ID() string {
+	return IDFromContext(r.Context())
+}
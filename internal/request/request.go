@@ -2,16 +2,26 @@ package request
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"goHttp/internal/headers"
 )
 
 const buffSize = 8
 
+// MaxBodyBytes caps the body of a request. Bodies are read into memory
+// whole before the handler runs, so one announcing more than this is
+// refused before any of it is read.
+const MaxBodyBytes = 10 << 20
+
 type parseState int
 
 const (
@@ -33,8 +43,8 @@ var (
 	ErrorInvalidMethodName = fmt.Errorf("method does not contain only captial alphabetic characters")
 	ErrorNoSlash           = fmt.Errorf("couldn't find '/' in HTTP version")
 	ErrorUnexectedEOF      = fmt.Errorf("unexpected EOF: missing end of headers")
-	ErrorBodyLengthGreater = fmt.Errorf("actual body length is greater than reported body length")
 	ErrorBodyLengthLesser  = fmt.Errorf("actual body length is less than reported body length")
+	ErrorBodyTooLarge      = fmt.Errorf("reported body length is over the limit")
 )
 
 type RequestLine struct {
@@ -47,13 +57,60 @@ type Request struct {
 	RequestLine RequestLine
 	Headers     headers.Headers
 	Body        []byte
-	state       parseState
+	// RemoteAddr is the address of the client that sent the request,
+	// filled in by the server
+	RemoteAddr string
+	// LocalAddr is the server address the request came in on
+	LocalAddr string
+	// TLS describes the connection when it came in over TLS, nil otherwise
+	TLS *tls.ConnectionState
+	// ConnID tells the server's connections apart, counting up from 1
+	ConnID uint64
+	// Seq is the number of the request on its connection, starting at 1
+	Seq int
+	// ReceivedAt is when the server finished reading the request
+	ReceivedAt time.Time
+
+	state parseState
+	ctx   context.Context
+}
+
+// Context is cancelled when the client goes away, the server shuts down or
+// the request runs out of time. Requests not served by a Server get
+// context.Background.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r using ctx, for middleware that
+// attaches values or deadlines for the handlers after it
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
 }
 
 func NewRequest() *Request {
 	return &Request{state: InitializedState, Headers: headers.NewHeaders()}
 }
 
+// Path returns the decoded path of the request target without its query.
+// Absolute-form targets, as sent to proxies, are reduced to their path too.
+func (r *Request) Path() string {
+	u, err := url.ParseRequestURI(r.RequestLine.RequestTarget)
+	if err != nil {
+		path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+		return path
+	}
+	return u.Path
+}
+
 func onlyUpper(slice []byte) bool {
 	// there is no "captial empty string"
 	if len(slice) == 0 {
@@ -111,11 +168,9 @@ func parseBody(req *Request, data []byte, expectedLength int) (int, error) {
 		return 0, nil
 	}
 
-	if actual > expectedLength {
-		return 0, ErrorBodyLengthGreater
-	}
-
-	req.Body = data[:expectedLength]
+	// anything past the body belongs to whatever follows the request on
+	// the connection, and the read buffer gets reused for it
+	req.Body = bytes.Clone(data[:expectedLength])
 	req.state = DoneState
 	return expectedLength, nil
 }
@@ -164,6 +219,9 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		if i > MaxBodyBytes {
+			return 0, ErrorBodyTooLarge
+		}
 
 		n, err := parseBody(r, data, i)
 		if err != nil {
@@ -195,6 +253,14 @@ func (r *Request) parse(data []byte) (int, error) {
 }
 
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	req, _, err := ReadRequest(reader)
+	return req, err
+}
+
+// ReadRequest parses a request like RequestFromReader and also returns the
+// bytes it read past the end of the request, such as a pipelined request or
+// the first bytes of an upgraded protocol
+func ReadRequest(reader io.Reader) (*Request, []byte, error) {
 	buff := make([]byte, buffSize)
 	readToIndex := 0
 
@@ -223,17 +289,17 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 					actual := readToIndex
 
 					if actual < expect {
-						return nil, ErrorBodyLengthLesser
+						return nil, nil, ErrorBodyLengthLesser
 					}
 				}
 
 				// by the time the final read goes off, we should be done parsing
 				if req.state != DoneState {
-					return nil, ErrorUnexectedEOF
+					return nil, nil, ErrorUnexectedEOF
 				}
 				break
 			}
-			return nil, err
+			return nil, nil, err
 		}
 		// keeping track of how many bytes that were actually read
 		readToIndex += nBytes
@@ -241,7 +307,7 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		// only parse the bytes in the buff that were actually read
 		num, err := req.parse(buff[:readToIndex])
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		// nothing was parsed with no error, simply need more data.
 		// so we should try to read in more
@@ -258,5 +324,5 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		// time to reset where we will be reading from
 		readToIndex -= num
 	}
-	return req, nil
+	return req, buff[:readToIndex], nil
 }
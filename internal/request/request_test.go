@@ -2,6 +2,7 @@ package request
 
 import (
 	"io"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -284,3 +285,48 @@ func TestBodyScenarios(t *testing.T) {
 	// Body must be empty because parser treats Content-Length as required.
 	assert.Equal(t, 0, len(r.Body))
 }
+
+func TestBodyTooLarge(t *testing.T) {
+	// refused from the header alone, without waiting for the body
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: " + strconv.Itoa(MaxBodyBytes+1) + "\r\n" +
+			"\r\n",
+		numBytesPerRead: 16,
+	}
+	_, err := RequestFromReader(reader)
+	assert.ErrorIs(t, err, ErrorBodyTooLarge)
+}
+
+func TestReadRequestRest(t *testing.T) {
+	t.Run("bytes after the body", func(t *testing.T) {
+		reader := &chunkReader{
+			data: "POST /a HTTP/1.1\r\n" +
+				"Content-Length: 5\r\n" +
+				"\r\n" +
+				"helloGET /b HTTP/1.1\r\n\r\n",
+			numBytesPerRead: 40,
+		}
+		r, rest, err := ReadRequest(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(r.Body))
+		// rest picks up where the request ended, and the reader where rest does
+		unread, _ := io.ReadAll(reader)
+		assert.Equal(t, "GET /b HTTP/1.1\r\n\r\n", string(rest)+string(unread))
+	})
+
+	t.Run("bytes after the headers", func(t *testing.T) {
+		reader := &chunkReader{
+			data: "GET /chat HTTP/1.1\r\n" +
+				"Upgrade: echo\r\n" +
+				"\r\n" +
+				"\x81\x02hi",
+			numBytesPerRead: 64,
+		}
+		r, rest, err := ReadRequest(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "/chat", r.RequestLine.RequestTarget)
+		unread, _ := io.ReadAll(reader)
+		assert.Equal(t, "\x81\x02hi", string(rest)+string(unread))
+	})
+}
@@ -0,0 +1,34 @@
+package response
+
+import (
+	"sync/atomic"
+	"time"
+
+	"goHttp/internal/headers"
+)
+
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+// the Date header only changes once a second, so there is no need
+// to format it again for every response in between
+var dateCache atomic.Pointer[cachedDate]
+
+// FormatDate formats t the way HTTP date headers expect
+func FormatDate(t time.Time) string {
+	return t.UTC().Format(headers.TimeFormat)
+}
+
+func currentDate() string {
+	now := time.Now()
+	sec := now.Unix()
+	if c := dateCache.Load(); c != nil && c.unix == sec {
+		return c.value
+	}
+
+	value := FormatDate(now)
+	dateCache.Store(&cachedDate{unix: sec, value: value})
+	return value
+}
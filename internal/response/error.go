@@ -0,0 +1,47 @@
+package response
+
+import "errors"
+
+// SetErrorHandler installs the function WriteError hands errors to. The server
+// uses this to plug in its error renderer for every response it creates.
+func (w *Writer) SetErrorHandler(f func(err error)) {
+	w.errorHandler = f
+}
+
+// WriteError turns err into a complete error response. It has to be called
+// before anything else is written. When err has a StatusCode() StatusCode
+// method that status is used, anything else is treated as a 500.
+func (w *Writer) WriteError(err error) error {
+	if w.state != WriteEmptyState {
+		return ErrorInvalidWriteSequence
+	}
+	if w.errorHandler != nil {
+		w.errorHandler(err)
+		return nil
+	}
+
+	// nobody told us how errors should look, so keep it to plain text
+	status := ErrorStatus(err)
+	body := StatusText(status)
+	if body == "" {
+		body = "Error"
+	}
+	if err := w.WriteStatusLine(status); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(GetDefaultHeaders(len(body))); err != nil {
+		return err
+	}
+	_, err = w.WriteBody([]byte(body))
+	return err
+}
+
+// ErrorStatus returns the status code carried by err, or StatusInServErr
+// when it does not carry one
+func ErrorStatus(err error) StatusCode {
+	var e interface{ StatusCode() StatusCode }
+	if errors.As(err, &e) {
+		return e.StatusCode()
+	}
+	return StatusInServErr
+}
@@ -0,0 +1,72 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"goHttp/internal/headers"
+)
+
+// StrongETag derives a strong entity tag from the content itself, so it
+// changes whenever a single byte of the content does
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// StrongETagFrom is StrongETag for content that is read from r
+// instead of sitting in memory
+func StrongETagFrom(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`, nil
+}
+
+// WeakETag derives a weak entity tag from a file's size and modification
+// time. It is cheap to compute but only tells that the content is probably
+// the same, which is fine for caching but not for byte ranges.
+func WeakETag(size int64, modTime time.Time) string {
+	return `W/"` + strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(modTime.UnixNano(), 16) + `"`
+}
+
+// notModifiedHeaders are the headers a 304 carries over from the 200 it
+// stands in for (RFC 9110 section 15.4.5)
+var notModifiedHeaders = []string{
+	"cache-control",
+	"content-location",
+	"date",
+	"etag",
+	"expires",
+	"last-modified",
+	"vary",
+	"connection",
+}
+
+// WriteNotModified writes a complete 304 Not Modified response. h are the
+// headers the full response would have had, only the ones relevant to a
+// 304 are sent along.
+func (w *Writer) WriteNotModified(h headers.Headers) error {
+	heads := headers.NewHeaders()
+	for key, val := range h {
+		for _, keep := range notModifiedHeaders {
+			if strings.ToLower(key) == keep {
+				heads.Set(key, val)
+			}
+		}
+	}
+	if len(heads) == 0 {
+		// WriteHeaders wants at least one header
+		heads.Set("Connection", "close")
+	}
+
+	if err := w.WriteStatusLine(StatusNotModified); err != nil {
+		return err
+	}
+	return w.WriteHeaders(heads)
+}
@@ -0,0 +1,108 @@
+package response
+
+import (
+	"io"
+	"maps"
+	"strconv"
+	"strings"
+
+	"goHttp/internal/headers"
+)
+
+// BodyFilter gets a look at the status and headers right before they are
+// written and may change them (the handler's own map is left alone). If it
+// returns a non-nil io.WriteCloser, every body byte passes through it on the
+// way to next, and Close is called once the body is complete. A returned
+// writer that also has a Flush() error method is flushed along with the Writer.
+type BodyFilter func(status StatusCode, h headers.Headers, next io.Writer) io.WriteCloser
+
+// AddBodyFilter registers f for this response. Filters have to be added before
+// the headers are written. The filter added first sits closest to the connection,
+// so it sees the bytes produced by every filter added after it.
+func (w *Writer) AddBodyFilter(f BodyFilter) error {
+	if w.state != WriteEmptyState && w.state != WriteStatusLineState {
+		return ErrorInvalidWriteSequence
+	}
+	w.filters = append(w.filters, f)
+	return nil
+}
+
+// applyFilters runs the registered filters over a copy of h, builds the chain
+// body bytes will be written through, and works out how the body is framed
+func (w *Writer) applyFilters(h headers.Headers) headers.Headers {
+	if len(w.filters) > 0 || len(w.declared) > 0 || h["trailer"] != "" {
+		h = maps.Clone(h)
+	}
+
+	w.body = framer{w}
+	for _, f := range w.filters {
+		if wc := f(w.status, h, w.body); wc != nil {
+			w.body = wc
+			// outermost filter first, so its output still has somewhere to go
+			// when the ones below it get closed
+			w.closers = append([]io.Closer{wc}, w.closers...)
+		}
+	}
+
+	// after the filters, which may declare trailers of their own
+	w.declareTrailers(h)
+
+	te, _ := h.Get("Transfer-Encoding")
+	w.chunked = strings.Contains(strings.ToLower(te), "chunked")
+	return h
+}
+
+func (w *Writer) closeFilters() error {
+	closers := w.closers
+	w.closers = nil
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// framer is the last stop before the connection. It wraps body bytes in
+// chunks when the response uses chunked transfer encoding.
+type framer struct {
+	w *Writer
+}
+
+func (f framer) Write(p []byte) (int, error) {
+	if f.w.omitBody {
+		return len(p), nil
+	}
+	if !f.w.chunked {
+		n, err := f.w.conn.Write(p)
+		f.w.bodyBytes += int64(n)
+		return n, err
+	}
+	// a zero sized chunk would end the body early
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// size line is the chunk length in hex, formatted into a stack buffer
+	// so writing a chunk does not allocate
+	var sizeBuf [20]byte
+	sizeLine := strconv.AppendUint(sizeBuf[:0], uint64(len(p)), 16)
+	for i, c := range sizeLine {
+		// keep the uppercase hex digits we have always sent
+		if c >= 'a' && c <= 'f' {
+			sizeLine[i] = c - ('a' - 'A')
+		}
+	}
+	sizeLine = append(sizeLine, CRLF...)
+
+	if _, err := f.w.conn.Write(sizeLine); err != nil {
+		return 0, err
+	}
+	n, err := f.w.conn.Write(p)
+	f.w.bodyBytes += int64(n)
+	if err != nil {
+		return n, err
+	}
+	_, err = f.w.conn.Write(CRLF)
+	return n, err
+}
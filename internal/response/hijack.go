@@ -0,0 +1,64 @@
+package response
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+var ErrorNotHijackable = fmt.Errorf("the writer's connection can not be hijacked")
+
+// Hijacker hands over the connection a Writer belongs to, along with the
+// bytes that were already read off it but not consumed by the request
+type Hijacker func() (net.Conn, []byte, error)
+
+// SetHijacker installs the function Hijack gets the connection from. The
+// server sets it for every response it creates.
+func (w *Writer) SetHijacker(f Hijacker) {
+	w.hijacker = f
+}
+
+// Hijack hands the raw connection over to the caller, who is responsible
+// for closing it from then on. Whatever was written so far is flushed
+// first, and the writer refuses any further writes. The returned bytes
+// were sent by the client after the request, and have to be handled
+// before anything read from the connection.
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.hijacker == nil {
+		return nil, nil, ErrorNotHijackable
+	}
+	if w.state == WriteHijackedState {
+		return nil, nil, ErrorInvalidWriteSequence
+	}
+	if err := w.conn.Flush(); err != nil {
+		return nil, nil, err
+	}
+
+	conn, buffered, err := w.hijacker()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.state = WriteHijackedState
+	w.hijackedAt = time.Now()
+	return conn, buffered, nil
+}
+
+// HijackedAt returns when the connection was hijacked, the zero time if it
+// was not. What happens on the connection afterwards is up to the
+// hijacker, so logs and metrics stop timing the request there.
+func (w *Writer) HijackedAt() time.Time {
+	return w.hijackedAt
+}
+
+// RecordHijackedStatus notes the status of a response the caller wrote on
+// the hijacked connection itself, so Status reports it. A status written
+// through the Writer before the hijack is kept.
+func (w *Writer) RecordHijackedStatus(code StatusCode) error {
+	if w.state != WriteHijackedState {
+		return fmt.Errorf("%w: %s", ErrorInvalidWriteSequence, w.state)
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package response
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"log/slog"
 	"strconv"
+	"time"
 
 	"goHttp/internal/headers"
 )
@@ -14,6 +17,7 @@ type (
 )
 
 var (
+	CRLF                      = []byte("\r\n")
 	ErrorInvalidStatus        = fmt.Errorf("encountered an invalid status code")
 	ErrorNoHeaders            = fmt.Errorf("found no headers to write for response")
 	ErrorInvalidWriteSequence = fmt.Errorf("have not followed the correct order of response writes")
@@ -59,17 +63,147 @@ const (
 	WriteBodyState        writerState = "writing body"
 	WriteChunkedBodyState writerState = "writing chunked body"
 	WriteDoneState        writerState = "done writing everything"
+	WriteHijackedState    writerState = "connection hijacked"
 
 	version = "HTTP/1.1"
+
+	// big enough to hold the status line and headers of a typical response,
+	// so they go out in a single write together with the start of the body
+	writeBufferSize = 4096
 )
 
+// Writer writes a response to conn through a buffer. Bytes are only pushed to
+// the connection when the buffer fills up, after every chunk of a chunked body,
+// once the response is finished, or when Flush is called.
 type Writer struct {
-	state writerState
-	conn  io.Writer
+	state  writerState
+	conn   *bufio.Writer
+	status StatusCode
+
+	// body framing is decided from the headers that actually get written,
+	// which body filters may have changed from what the handler passed in
+	chunked bool
+	// headers as the handler passed them, before filters changed them
+	headers headers.Headers
+	filters []BodyFilter
+	// body is where body bytes go: the framer, or the outermost filter around it
+	body    io.Writer
+	closers []io.Closer
+	// bodyBytes counts what the framer sent, after filters and before chunking
+	bodyBytes int64
+
+	// omitBody is set for responses that must not carry a body, like the
+	// answer to a HEAD request. Body writes still succeed but nothing is sent.
+	omitBody     bool
+	serverName   string
+	errorHandler func(err error)
+	hijacker     Hijacker
+	hijackedAt   time.Time
+
+	// trailer fields passed to DeclareTrailer, the full set of declared
+	// ones once the headers are written, and the values set so far
+	declared     []string
+	trailerNames map[string]bool
+	trailers     headers.Headers
+	trailersSent bool
+
+	logger *slog.Logger
 }
 
+// discardLogger is what a Writer logs to until SetLogger is called
+var discardLogger = slog.New(slog.DiscardHandler)
+
 func NewWriter(conn io.Writer) *Writer {
-	return &Writer{state: WriteEmptyState, conn: conn}
+	return &Writer{state: WriteEmptyState, conn: bufio.NewWriterSize(conn, writeBufferSize), logger: discardLogger}
+}
+
+// SetLogger sets the logger handlers and helpers writing this response log
+// to. The server hands in one that carries the connection and request.
+func (w *Writer) SetLogger(l *slog.Logger) {
+	w.logger = l
+}
+
+// Logger returns the logger set with SetLogger, one that discards
+// everything by default
+func (w *Writer) Logger() *slog.Logger {
+	return w.logger
+}
+
+// OmitBody makes the writer swallow the body while still sending the headers
+// that describe it, which is what a response to a HEAD request looks like
+func (w *Writer) OmitBody() {
+	w.omitBody = true
+}
+
+// SetServerName sets the Server header sent with every response that
+// does not set one itself. An empty name leaves the header out.
+func (w *Writer) SetServerName(name string) {
+	w.serverName = name
+}
+
+// Status returns the status code written so far, or 0 if the
+// status line has not been written yet
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// Headers returns the header fields as the handler passed them to
+// WriteHeaders, before body filters changed them, or nil before that
+func (w *Writer) Headers() headers.Headers {
+	return w.headers
+}
+
+// BytesWritten returns how many body bytes went out so far, as they
+// appear on the wire after body filters but without chunk framing
+func (w *Writer) BytesWritten() int64 {
+	return w.bodyBytes
+}
+
+// Flush sends everything buffered so far, including anything held back by
+// body filters, to the underlying connection
+func (w *Writer) Flush() error {
+	for _, c := range w.closers {
+		if f, ok := c.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return w.conn.Flush()
+}
+
+// Finish completes whatever the handler left unfinished: body filters get
+// closed, a chunked body gets its last chunk, trailers that were announced
+// but never written get their closing line, and the buffer is flushed.
+// A status line without headers is completed with an empty body, and
+// reported with ErrorNoHeaders since the handler meant to send more.
+func (w *Writer) Finish() error {
+	switch w.state {
+	case WriteHijackedState:
+		// the connection is not ours to write to anymore
+		return nil
+	case WriteStatusLineState:
+		if err := w.WriteHeaders(GetDefaultHeaders(0)); err != nil {
+			return err
+		}
+		// filters may have been set up by the headers, they get closed too
+		w.state = WriteChunkedBodyState
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: status line was written without headers", ErrorNoHeaders)
+	case WriteHeadersState, WriteBodyState, WriteChunkedBodyState:
+		w.state = WriteChunkedBodyState
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+	case WriteDoneState:
+		// WriteChunkedBodyDoneWithTrailers was not followed by WriteTrailers
+		if !w.trailersSent {
+			return w.WriteTrailers(nil)
+		}
+	}
+	return w.conn.Flush()
 }
 
 func GetDefaultHeaders(contentLen int) headers.Headers {
@@ -82,55 +216,56 @@ func GetDefaultHeaders(contentLen int) headers.Headers {
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.state != WriteEmptyState {
-		fmt.Printf("current write state: %s", w.state)
-		return ErrorInvalidWriteSequence
+		return fmt.Errorf("%w: %s", ErrorInvalidWriteSequence, w.state)
 	}
-	w.state = WriteStatusLineState
-
-	statusLine := ""
-	switch statusCode {
-	case StatusOK:
-		statusLine = version + " 200 OK\r\n"
-	case StatusBad:
-		statusLine = version + " 400 Bad Request\r\n"
-	case StatusInServErr:
-		statusLine = version + " 500 Internal Server Error\r\n"
-	default:
+	// a bad code leaves the writer untouched, so an error page can still go out
+	if statusCode < 100 || statusCode > 599 {
 		return ErrorInvalidStatus
 	}
+	w.state = WriteStatusLineState
+	w.status = statusCode
+	if !bodyAllowed(statusCode) {
+		w.omitBody = true
+	}
 
-	_, err := w.conn.Write([]byte(statusLine))
+	// reason phrase may be empty for codes we do not know,
+	// but the space in front of it has to stay
+	statusLine := version + " " + strconv.Itoa(int(statusCode)) + " " + StatusText(statusCode) + "\r\n"
+
+	_, err := w.conn.WriteString(statusLine)
 	return err
 }
 
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	if w.state != WriteStatusLineState {
-		fmt.Printf("current write state: %s", w.state)
-		return ErrorInvalidWriteSequence
+		return fmt.Errorf("%w: %s", ErrorInvalidWriteSequence, w.state)
 	}
 	if len(headers) == 0 {
 		return ErrorNoHeaders
 	}
 
 	w.state = WriteHeadersState
+	w.headers = headers
 
-	for key, val := range headers {
-		header := fmt.Sprintf("%s: %s\r\n", key, val)
-		_, err := w.conn.Write([]byte(header))
-		if err != nil {
-			return err
-		}
+	headers = w.applyFilters(headers)
+	if err := w.writeFields(headers); err != nil {
+		return err
+	}
+	if date, _ := headers.Get("Date"); date == "" {
+		w.writeField("date", currentDate())
+	}
+	if server, _ := headers.Get("Server"); server == "" && w.serverName != "" {
+		w.writeField("server", w.serverName)
 	}
 
 	// need extra CRLF to separate headers from body
-	_, err := w.conn.Write([]byte("\r\n"))
+	_, err := w.conn.WriteString("\r\n")
 	return err
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.state != WriteHeadersState {
-		fmt.Printf("current write state: %s", w.state)
-		return 0, ErrorInvalidWriteSequence
+	if w.state != WriteHeadersState && w.state != WriteBodyState {
+		return 0, fmt.Errorf("%w: %s", ErrorInvalidWriteSequence, w.state)
 	}
 	w.state = WriteBodyState
 
@@ -138,7 +273,7 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 		return 0, nil
 	}
 
-	n, err := w.conn.Write(p)
+	n, err := w.body.Write(p)
 	return n, err
 }
 
@@ -150,24 +285,17 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 		return 0, ErrorInvalidWriteSequence
 	}
 
-	total := 0
-	num := len(p)
-	if num == 0 {
+	if len(p) == 0 {
 		return 0, nil
 	}
 
-	sizeLine := fmt.Sprintf("%X\r\n", num)
-	dataLine := fmt.Sprintf("%s\r\n", p)
-	chunk := [2]string{sizeLine, dataLine}
-
-	for _, v := range chunk {
-		n, err := w.conn.Write([]byte(v))
-		if err != nil {
-			return 0, err
-		}
-		total += n
+	n, err := w.body.Write(p)
+	if err != nil {
+		return n, err
 	}
-	return total, nil
+
+	// flush every chunk so a streamed body reaches the client as it is produced
+	return n, w.Flush()
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
@@ -176,9 +304,30 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	}
 	w.state = WriteDoneState
 
+	if err := w.closeFilters(); err != nil {
+		return 0, err
+	}
+	if !w.chunked || w.omitBody {
+		w.trailersSent = true
+		return 0, w.conn.Flush()
+	}
+
+	if len(w.trailers) > 0 {
+		// trailers set along the way go out with the last chunk
+		n, err := w.conn.WriteString("0\r\n")
+		if err != nil {
+			return n, err
+		}
+		return n, w.WriteTrailers(nil)
+	}
+
+	w.trailersSent = true
 	endingChunk := "0\r\n\r\n"
-	n, err := w.conn.Write([]byte(endingChunk))
-	return n, err
+	n, err := w.conn.WriteString(endingChunk)
+	if err != nil {
+		return n, err
+	}
+	return n, w.conn.Flush()
 }
 
 func (w *Writer) WriteChunkedBodyDoneWithTrailers() (int, error) {
@@ -187,26 +336,94 @@ func (w *Writer) WriteChunkedBodyDoneWithTrailers() (int, error) {
 	}
 	w.state = WriteDoneState
 
+	if err := w.closeFilters(); err != nil {
+		return 0, err
+	}
+
+	if w.omitBody {
+		return 0, nil
+	}
+
 	// does not have the extra CRLF as we expect trailers later
 	endingChunk := "0\r\n"
-	n, err := w.conn.Write([]byte(endingChunk))
+	n, err := w.conn.WriteString(endingChunk)
 	return n, err
 }
 
+// WriteTrailers sends the trailer fields in h together with the ones set
+// with SetTrailer, values in h taking precedence. Every field has to be
+// declared in the Trailer header.
 func (w *Writer) WriteTrailers(h headers.Headers) error {
 	if w.state != WriteDoneState {
 		return ErrorInvalidWriteSequence
 	}
+	if err := w.checkTrailers(h); err != nil {
+		return err
+	}
+	w.trailersSent = true
+	if w.omitBody {
+		return w.conn.Flush()
+	}
 
+	for key, val := range w.trailers {
+		if _, ok := h[key]; !ok {
+			w.writeField(key, val)
+		}
+	}
+	if err := w.writeFields(h); err != nil {
+		return err
+	}
+
+	// need extra CRLF to finish the trailer
+	if _, err := w.conn.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return w.conn.Flush()
+}
+
+// writeFields writes every "key: value" line of h into the buffer.
+// used for both headers and trailers since they share the same format
+func (w *Writer) writeFields(h headers.Headers) error {
 	for key, val := range h {
-		trailer := fmt.Sprintf("%s: %s\r\n", key, val)
-		_, err := w.conn.Write([]byte(trailer))
-		if err != nil {
+		if err := w.writeField(key, val); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	// need extra CRLF to finish the trailer
-	_, err := w.conn.Write([]byte("\r\n"))
+func (w *Writer) writeField(key, val string) error {
+	w.conn.WriteString(key)
+	w.conn.WriteString(": ")
+	w.conn.WriteString(val)
+	_, err := w.conn.WriteString("\r\n")
 	return err
 }
+
+// WriteBodyFrom streams everything in r into the body. It stops reading
+// early when the body is omitted, so a HEAD response does not pull a whole
+// file off disk for nothing.
+func (w *Writer) WriteBodyFrom(r io.Reader) (int64, error) {
+	if w.state != WriteHeadersState && w.state != WriteBodyState {
+		return 0, ErrorInvalidWriteSequence
+	}
+	w.state = WriteBodyState
+	if w.omitBody {
+		return 0, nil
+	}
+	return io.Copy(w.body, r)
+}
+
+// BodyWriter returns the body as an io.Writer, for code that wants to write
+// into it with io.Copy, fmt.Fprintf, encoders and the like
+func (w *Writer) BodyWriter() io.Writer {
+	return bodyWriter{w}
+}
+
+type bodyWriter struct {
+	w *Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.WriteBody(p)
+}
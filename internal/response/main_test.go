@@ -0,0 +1,333 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/headers"
+)
+
+// countingWriter stands in for a net.Conn and counts how many times Write is
+// called, which maps one to one onto write syscalls for a real connection
+type countingWriter struct {
+	buf    bytes.Buffer
+	writes int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.writes++
+	return cw.buf.Write(p)
+}
+
+func TestWriteFullResponse(t *testing.T) {
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+
+	heads := headers.NewHeaders()
+	heads.Set("Content-Length", "5")
+	heads.Set("Date", "Tue, 15 Nov 1994 08:12:31 GMT")
+
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(heads))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// nothing should hit the connection until we flush
+	assert.Equal(t, 0, conn.writes)
+	require.NoError(t, w.Flush())
+
+	assert.Equal(t, 1, conn.writes)
+	assert.Contains(t, conn.buf.String(), "content-length: 5\r\n")
+	assert.Contains(t, conn.buf.String(), "date: Tue, 15 Nov 1994 08:12:31 GMT\r\n")
+	assert.True(t, strings.HasSuffix(conn.buf.String(), "\r\n\r\nhello"))
+}
+
+func TestInvalidStatus(t *testing.T) {
+	var conn bytes.Buffer
+	w := NewWriter(&conn)
+
+	assert.ErrorIs(t, w.WriteStatusLine(StatusCode(42)), ErrorInvalidStatus)
+	assert.Zero(t, w.Status())
+
+	// nothing was written, so the writer can still answer with an error
+	require.NoError(t, w.WriteError(ErrorInvalidStatus))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(conn.String(), "HTTP/1.1 500 "))
+}
+
+func TestAutomaticHeaders(t *testing.T) {
+	var conn bytes.Buffer
+	w := NewWriter(&conn)
+	w.SetServerName("goHttp")
+
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.NoError(t, w.Finish())
+
+	assert.Regexp(t, `\r\ndate: \w{3}, \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} GMT\r\n`, conn.String())
+	assert.Contains(t, conn.String(), "\r\nserver: goHttp\r\n")
+}
+
+func TestOmitBody(t *testing.T) {
+	t.Run("content length body", func(t *testing.T) {
+		var conn bytes.Buffer
+		w := NewWriter(&conn)
+		w.OmitBody()
+
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+		n, err := w.WriteBody([]byte("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+		require.NoError(t, w.Finish())
+
+		assert.Contains(t, conn.String(), "content-length: 5\r\n")
+		assert.True(t, strings.HasSuffix(conn.String(), "\r\n\r\n"))
+	})
+
+	t.Run("chunked body", func(t *testing.T) {
+		var conn bytes.Buffer
+		w := NewWriter(&conn)
+		w.OmitBody()
+
+		heads := headers.NewHeaders()
+		heads.Set("Transfer-Encoding", "chunked")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(heads))
+		_, err := w.WriteChunkedBody([]byte("hello"))
+		require.NoError(t, err)
+		_, err = w.WriteChunkedBodyDone()
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasSuffix(conn.String(), "\r\n\r\n"))
+		assert.NotContains(t, conn.String(), "hello")
+		assert.NotContains(t, conn.String(), "\r\n0\r\n")
+	})
+}
+
+func TestHijack(t *testing.T) {
+	t.Run("needs a hijacker", func(t *testing.T) {
+		w := NewWriter(&bytes.Buffer{})
+		_, _, err := w.Hijack()
+		assert.ErrorIs(t, err, ErrorNotHijackable)
+	})
+
+	t.Run("hands over the connection", func(t *testing.T) {
+		server, client := net.Pipe()
+		defer client.Close()
+
+		w := NewWriter(server)
+		w.SetHijacker(func() (net.Conn, []byte, error) { return server, []byte("early"), nil })
+		require.NoError(t, w.WriteStatusLine(StatusSwitchingProtocols))
+		require.NoError(t, w.WriteHeaders(headers.Headers{"upgrade": "echo"}))
+
+		// the head was only buffered so far, hijacking pushes it out
+		got := make(chan string)
+		go func() {
+			buf := make([]byte, 256)
+			n, _ := client.Read(buf)
+			got <- string(buf[:n])
+		}()
+		conn, buffered, err := w.Hijack()
+		require.NoError(t, err)
+		head := <-got
+		assert.True(t, strings.HasPrefix(head, "HTTP/1.1 101 Switching Protocols\r\nupgrade: echo\r\n"), head)
+		assert.True(t, strings.HasSuffix(head, "\r\n\r\n"), head)
+		assert.Equal(t, server, conn)
+		assert.Equal(t, "early", string(buffered))
+
+		_, err = w.WriteBody([]byte("nope"))
+		assert.ErrorIs(t, err, ErrorInvalidWriteSequence)
+		assert.NoError(t, w.Finish())
+		_, _, err = w.Hijack()
+		assert.ErrorIs(t, err, ErrorInvalidWriteSequence)
+		// the 101 written before the hijack stands
+		assert.False(t, w.HijackedAt().IsZero())
+		require.NoError(t, w.RecordHijackedStatus(StatusOK))
+		assert.Equal(t, StatusSwitchingProtocols, w.Status())
+	})
+
+	t.Run("status answered on the connection", func(t *testing.T) {
+		server, client := net.Pipe()
+		defer client.Close()
+		w := NewWriter(server)
+		assert.ErrorIs(t, w.RecordHijackedStatus(StatusOK), ErrorInvalidWriteSequence)
+
+		w.SetHijacker(func() (net.Conn, []byte, error) { return server, nil, nil })
+		_, _, err := w.Hijack()
+		require.NoError(t, err)
+		require.NoError(t, w.RecordHijackedStatus(StatusOK))
+		assert.Equal(t, StatusOK, w.Status())
+	})
+}
+
+func TestWriteChunkedBody(t *testing.T) {
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+
+	heads := headers.NewHeaders()
+	heads.Set("Transfer-Encoding", "chunked")
+	heads.Set("Date", "Tue, 15 Nov 1994 08:12:31 GMT")
+
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(heads))
+
+	_, err := w.WriteChunkedBody([]byte("hello world!"))
+	require.NoError(t, err)
+	// every chunk gets flushed so streamed responses are not held back
+	assert.Equal(t, 1, conn.writes)
+
+	_, err = w.WriteChunkedBody([]byte("bye"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, conn.writes)
+	assert.True(t, strings.HasSuffix(conn.buf.String(),
+		"\r\n\r\nC\r\nhello world!\r\n3\r\nbye\r\n0\r\n\r\n"))
+}
+
+func TestWriteTrailers(t *testing.T) {
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+
+	heads := headers.NewHeaders()
+	heads.Set("Transfer-Encoding", "chunked")
+	heads.Set("Trailer", "X-Content-Length")
+	trails := headers.NewHeaders()
+	trails.Set("X-Content-Length", "2")
+
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(heads))
+	_, err := w.WriteChunkedBody([]byte("hi"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDoneWithTrailers()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(trails))
+
+	assert.True(t, strings.HasSuffix(conn.buf.String(), "2\r\nhi\r\n0\r\nx-content-length: 2\r\n\r\n"))
+}
+
+func TestDeclaredTrailers(t *testing.T) {
+	t.Run("set while streaming", func(t *testing.T) {
+		var conn bytes.Buffer
+		w := NewWriter(&conn)
+
+		require.NoError(t, w.DeclareTrailer("X-Checksum"))
+		assert.ErrorIs(t, w.SetTrailer("X-Other", "1"), ErrorUndeclaredTrailer)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		// a declared trailer turns a fixed length body into a chunked one
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+		_, err := w.WriteBody([]byte("hi"))
+		require.NoError(t, err)
+		require.NoError(t, w.SetTrailer("X-Checksum", "abc"))
+		require.NoError(t, w.Finish())
+
+		out := conn.String()
+		assert.Contains(t, out, "\r\ntrailer: X-Checksum\r\n")
+		assert.Contains(t, out, "\r\ntransfer-encoding: chunked\r\n")
+		assert.NotContains(t, out, "content-length")
+		assert.True(t, strings.HasSuffix(out, "2\r\nhi\r\n0\r\nx-checksum: abc\r\n\r\n"), out)
+		assert.ErrorIs(t, w.SetTrailer("X-Checksum", "def"), ErrorTrailersAlreadySent)
+	})
+
+	t.Run("framing fields can not be trailers", func(t *testing.T) {
+		w := NewWriter(&bytes.Buffer{})
+		assert.ErrorIs(t, w.DeclareTrailer("Content-Length"), ErrorForbiddenTrailer)
+	})
+
+	t.Run("undeclared trailers are refused", func(t *testing.T) {
+		var conn bytes.Buffer
+		w := NewWriter(&conn)
+
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked"}))
+		_, err := w.WriteChunkedBody([]byte("hi"))
+		require.NoError(t, err)
+		_, err = w.WriteChunkedBodyDoneWithTrailers()
+		require.NoError(t, err)
+		err = w.WriteTrailers(headers.Headers{"x-content-length": "0"})
+		assert.ErrorIs(t, err, ErrorUndeclaredTrailer)
+	})
+}
+
+func TestFinish(t *testing.T) {
+	t.Run("status line without headers", func(t *testing.T) {
+		var conn bytes.Buffer
+		w := NewWriter(&conn)
+
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		assert.ErrorIs(t, w.Finish(), ErrorNoHeaders)
+		// the response is complete now
+		require.NoError(t, w.Finish())
+
+		out := conn.String()
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+		assert.Contains(t, out, "\r\ncontent-length: 0\r\n")
+		assert.True(t, strings.HasSuffix(out, "\r\n\r\n"), out)
+	})
+
+	t.Run("trailers never written", func(t *testing.T) {
+		var conn bytes.Buffer
+		w := NewWriter(&conn)
+
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked"}))
+		_, err := w.WriteChunkedBody([]byte("hi"))
+		require.NoError(t, err)
+		_, err = w.WriteChunkedBodyDoneWithTrailers()
+		require.NoError(t, err)
+		require.NoError(t, w.Finish())
+
+		assert.True(t, strings.HasSuffix(conn.String(), "2\r\nhi\r\n0\r\n\r\n"), conn.String())
+		// nothing is written twice
+		size := conn.Len()
+		require.NoError(t, w.Finish())
+		assert.Equal(t, size, conn.Len())
+	})
+}
+
+func BenchmarkWriteResponse(b *testing.B) {
+	body := []byte(StatusOKBody)
+	heads := GetDefaultHeaders(len(body))
+	heads.Set("Cache-Control", "no-cache")
+	heads.Set("X-Frame-Options", "DENY")
+
+	conn := &countingWriter{}
+	b.ReportAllocs()
+	for b.Loop() {
+		conn.buf.Reset()
+		w := NewWriter(conn)
+		_ = w.WriteStatusLine(StatusOK)
+		_ = w.WriteHeaders(heads)
+		_, _ = w.WriteBody(body)
+		_ = w.Flush()
+	}
+	b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkWriteChunkedBody(b *testing.B) {
+	chunk := bytes.Repeat([]byte("a"), 1024)
+	heads := headers.NewHeaders()
+	heads.Set("Transfer-Encoding", "chunked")
+
+	conn := &countingWriter{}
+	w := NewWriter(io.Discard)
+	_ = w.WriteStatusLine(StatusOK)
+	_ = w.WriteHeaders(heads)
+	w.conn.Reset(conn)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		conn.buf.Reset()
+		_, _ = w.WriteChunkedBody(chunk)
+	}
+	b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/op")
+}
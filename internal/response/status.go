@@ -0,0 +1,86 @@
+package response
+
+const (
+	StatusContinue           StatusCode = 100
+	StatusSwitchingProtocols StatusCode = 101
+
+	StatusCreated        StatusCode = 201
+	StatusAccepted       StatusCode = 202
+	StatusNoContent      StatusCode = 204
+	StatusPartialContent StatusCode = 206
+
+	StatusMovedPermanently  StatusCode = 301
+	StatusFound             StatusCode = 302
+	StatusSeeOther          StatusCode = 303
+	StatusNotModified       StatusCode = 304
+	StatusTemporaryRedirect StatusCode = 307
+	StatusPermanentRedirect StatusCode = 308
+
+	StatusUnauthorized                 StatusCode = 401
+	StatusForbidden                    StatusCode = 403
+	StatusNotFound                     StatusCode = 404
+	StatusMethodNotAllowed             StatusCode = 405
+	StatusNotAcceptable                StatusCode = 406
+	StatusProxyAuthRequired            StatusCode = 407
+	StatusRequestTimeout               StatusCode = 408
+	StatusPreconditionFailed           StatusCode = 412
+	StatusRequestEntityTooLarge        StatusCode = 413
+	StatusRequestedRangeNotSatisfiable StatusCode = 416
+	StatusUpgradeRequired              StatusCode = 426
+	StatusTooManyRequests              StatusCode = 429
+
+	StatusNotImplemented     StatusCode = 501
+	StatusBadGateway         StatusCode = 502
+	StatusServiceUnavailable StatusCode = 503
+	StatusGatewayTimeout     StatusCode = 504
+)
+
+var statusText = map[StatusCode]string{
+	StatusContinue:           "Continue",
+	StatusSwitchingProtocols: "Switching Protocols",
+
+	StatusOK:             "OK",
+	StatusCreated:        "Created",
+	StatusAccepted:       "Accepted",
+	StatusNoContent:      "No Content",
+	StatusPartialContent: "Partial Content",
+
+	StatusMovedPermanently:  "Moved Permanently",
+	StatusFound:             "Found",
+	StatusSeeOther:          "See Other",
+	StatusNotModified:       "Not Modified",
+	StatusTemporaryRedirect: "Temporary Redirect",
+	StatusPermanentRedirect: "Permanent Redirect",
+
+	StatusBad:                          "Bad Request",
+	StatusUnauthorized:                 "Unauthorized",
+	StatusForbidden:                    "Forbidden",
+	StatusNotFound:                     "Not Found",
+	StatusMethodNotAllowed:             "Method Not Allowed",
+	StatusNotAcceptable:                "Not Acceptable",
+	StatusProxyAuthRequired:            "Proxy Authentication Required",
+	StatusRequestTimeout:               "Request Timeout",
+	StatusPreconditionFailed:           "Precondition Failed",
+	StatusRequestEntityTooLarge:        "Content Too Large",
+	StatusRequestedRangeNotSatisfiable: "Range Not Satisfiable",
+	StatusUpgradeRequired:              "Upgrade Required",
+	StatusTooManyRequests:              "Too Many Requests",
+
+	StatusInServErr:          "Internal Server Error",
+	StatusNotImplemented:     "Not Implemented",
+	StatusBadGateway:         "Bad Gateway",
+	StatusServiceUnavailable: "Service Unavailable",
+	StatusGatewayTimeout:     "Gateway Timeout",
+}
+
+// StatusText returns the reason phrase for code, or an empty string
+// for codes we do not know a phrase for
+func StatusText(code StatusCode) string {
+	return statusText[code]
+}
+
+// bodyAllowed reports whether a response with this status may have a body
+// (RFC 9110 sections 15.2, 15.3.5 and 15.4.5)
+func bodyAllowed(code StatusCode) bool {
+	return code >= 200 && code != StatusNoContent && code != StatusNotModified
+}
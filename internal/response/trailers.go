@@ -0,0 +1,107 @@
+package response
+
+import (
+	"fmt"
+	"strings"
+
+	"goHttp/internal/headers"
+)
+
+var (
+	ErrorUndeclaredTrailer   = fmt.Errorf("trailer field was not declared in the Trailer header")
+	ErrorForbiddenTrailer    = fmt.Errorf("field is not allowed in a trailer")
+	ErrorTrailersAlreadySent = fmt.Errorf("trailers have already been sent")
+)
+
+// forbiddenTrailers frame the message or route it, and have to be known
+// before the body starts (RFC 9110 section 6.5.1)
+var forbiddenTrailers = map[string]bool{
+	"content-length":    true,
+	"transfer-encoding": true,
+	"trailer":           true,
+	"content-type":      true,
+	"content-encoding":  true,
+	"host":              true,
+}
+
+// DeclareTrailer announces trailer fields in the Trailer header, so their
+// values can be filled in with SetTrailer while or after the body is
+// written. It has to be called before WriteHeaders. Only a chunked body can
+// carry trailers, so a response that declares any is sent chunked.
+func (w *Writer) DeclareTrailer(names ...string) error {
+	if w.state != WriteEmptyState && w.state != WriteStatusLineState {
+		return ErrorInvalidWriteSequence
+	}
+	for _, name := range names {
+		if forbiddenTrailers[strings.ToLower(name)] {
+			return fmt.Errorf("%w: %s", ErrorForbiddenTrailer, name)
+		}
+	}
+	w.declared = append(w.declared, names...)
+	return nil
+}
+
+// SetTrailer sets the value of a trailer field, sent once the body is done.
+// The field has to be declared, either with DeclareTrailer or in the
+// Trailer header.
+func (w *Writer) SetTrailer(name, value string) error {
+	if w.trailersSent || w.state == WriteHijackedState {
+		return ErrorTrailersAlreadySent
+	}
+	if !w.trailerDeclared(name) {
+		return fmt.Errorf("%w: %s", ErrorUndeclaredTrailer, name)
+	}
+	if w.trailers == nil {
+		w.trailers = headers.NewHeaders()
+	}
+	w.trailers[strings.ToLower(name)] = value
+	return nil
+}
+
+func (w *Writer) trailerDeclared(name string) bool {
+	name = strings.ToLower(name)
+	if w.trailerNames != nil {
+		return w.trailerNames[name]
+	}
+	// the Trailer header is not final before the headers are written
+	for _, declared := range w.declared {
+		if strings.ToLower(declared) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// declareTrailers puts the declared trailers in the Trailer header of h and
+// makes sure the body is framed so they can be sent. h has to be a copy the
+// writer may change.
+func (w *Writer) declareTrailers(h headers.Headers) {
+	for _, name := range w.declared {
+		h.Set("Trailer", name)
+	}
+
+	w.trailerNames = map[string]bool{}
+	for _, name := range strings.Split(h["trailer"], ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			w.trailerNames[name] = true
+		}
+	}
+	if len(w.trailerNames) == 0 || !bodyAllowed(w.status) {
+		return
+	}
+	te := strings.ToLower(h["transfer-encoding"])
+	if !strings.Contains(te, "chunked") {
+		delete(h, "content-length")
+		h.Set("Transfer-Encoding", "chunked")
+	}
+}
+
+// checkTrailers makes sure only declared fields go out as trailers
+func (w *Writer) checkTrailers(h headers.Headers) error {
+	for name := range h {
+		if !w.trailerDeclared(name) {
+			return fmt.Errorf("%w: %s", ErrorUndeclaredTrailer, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"strconv"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+// ErrorRenderer writes the response for a request that failed, whether it
+// could not be parsed, had no matching route, or its handler gave up.
+// req is nil when the request could not be parsed at all.
+type ErrorRenderer func(w *response.Writer, req *request.Request, herr *HandlerError)
+
+// Problem is an RFC 9457 problem details object. HTML error templates
+// are executed with one as their data.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+var defaultErrorTemplate = template.Must(template.New("error").Parse(`<html>
+  <head>
+    <title>{{.Status}} {{.Title}}</title>
+  </head>
+  <body>
+    <h1>{{.Title}}</h1>
+    {{- if .Detail}}
+    <p>{{.Detail}}</p>
+    {{- end}}
+  </body>
+</html>`))
+
+// DefaultErrorRenderer is what a Server uses unless WithErrorRenderer says otherwise
+var DefaultErrorRenderer = NewErrorRenderer(nil)
+
+// NewErrorRenderer returns an ErrorRenderer that answers with
+// application/problem+json to clients that prefer JSON, and with tmpl
+// executed on the Problem to everybody else. A nil tmpl uses a plain
+// built in page.
+func NewErrorRenderer(tmpl *template.Template) ErrorRenderer {
+	if tmpl == nil {
+		tmpl = defaultErrorTemplate
+	}
+
+	return func(w *response.Writer, req *request.Request, herr *HandlerError) {
+		problem := herr.Problem(req)
+
+		accept := ""
+		if req != nil {
+			accept, _ = req.Headers.Get("Accept")
+		}
+		if prefersJSON(accept) {
+			ProblemJSONRenderer(w, req, herr)
+			return
+		}
+
+		var body bytes.Buffer
+		if err := tmpl.Execute(&body, problem); err != nil {
+			// a broken user template should not take the error response down with it
+			w.Logger().Error("executing error template", "err", err)
+			body.Reset()
+			_ = defaultErrorTemplate.Execute(&body, problem)
+		}
+		writeError(w, herr, "text/html", body.Bytes())
+	}
+}
+
+// ProblemJSONRenderer always answers with an application/problem+json body
+func ProblemJSONRenderer(w *response.Writer, req *request.Request, herr *HandlerError) {
+	body, err := json.Marshal(herr.Problem(req))
+	if err != nil {
+		// only plain strings and an int in there, so this can not happen
+		panic(err)
+	}
+	writeError(w, herr, "application/problem+json", body)
+}
+
+func writeError(w *response.Writer, herr *HandlerError, contentType string, body []byte) {
+	heads := response.GetDefaultHeaders(len(body))
+	_ = heads.Update("Content-Type", contentType)
+	for key, val := range herr.headers {
+		heads.Set(key, val)
+	}
+	WriteResponse(w, herr.status, heads, string(body))
+}
+
+// prefersJSON reports whether an Accept value ranks a JSON type above HTML.
+// Ties, wildcards and a missing header all go to HTML.
+func prefersJSON(accept string) bool {
+	htmlQ, jsonQ := 0.0, 0.0
+	for _, qv := range headers.ParseQValues(accept) {
+		switch qv.Value {
+		case "text/html", "application/xhtml+xml", "text/*", "*/*":
+			htmlQ = max(htmlQ, qv.Q)
+		case "application/problem+json", "application/json":
+			jsonQ = max(jsonQ, qv.Q)
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+// Error lets a HandlerError be passed around, and to response.Writer.WriteError, as an error
+func (e *HandlerError) Error() string {
+	if e.message == "" {
+		return strconv.Itoa(int(e.status)) + " " + response.StatusText(e.status)
+	}
+	return e.message
+}
+
+func (e *HandlerError) StatusCode() response.StatusCode {
+	return e.status
+}
+
+// WithHeader adds a header to send along with the error response,
+// like the Allow header a 405 needs
+func (e *HandlerError) WithHeader(key, value string) *HandlerError {
+	if e.headers == nil {
+		e.headers = headers.NewHeaders()
+	}
+	e.headers.Set(key, value)
+	return e
+}
+
+// Problem describes the error as RFC 9457 problem details.
+// req may be nil, in which case there is no instance to point at.
+func (e *HandlerError) Problem(req *request.Request) Problem {
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  response.StatusText(e.status),
+		Status: int(e.status),
+		Detail: e.message,
+	}
+	if req != nil {
+		problem.Instance = req.Path()
+	}
+	return problem
+}
+
+// asHandlerError turns any error into a HandlerError, keeping the status
+// if err carries one and hiding the details of unexpected errors
+func asHandlerError(err error) *HandlerError {
+	var herr *HandlerError
+	if errors.As(err, &herr) {
+		return herr
+	}
+	return NewHandlerError(response.ErrorStatus(err), "")
+}
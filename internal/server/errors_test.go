@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+func TestErrorRenderer(t *testing.T) {
+	failing := func(w *response.Writer, req *request.Request) {
+		_ = w.WriteError(NewHandlerError(response.StatusBad, "missing name"))
+	}
+
+	t.Run("html by default", func(t *testing.T) {
+		resp := serve(t, failing, "GET /hello HTTP/1.1\r\nAccept: text/html,*/*;q=0.8\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 400, resp.StatusCode)
+		assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+		assert.Contains(t, string(body), "<h1>Bad Request</h1>")
+		assert.Contains(t, string(body), "missing name")
+	})
+
+	t.Run("problem json when preferred", func(t *testing.T) {
+		resp := serve(t, failing, "GET /hello HTTP/1.1\r\nAccept: application/json\r\n\r\n")
+		assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+
+		var problem Problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+		assert.Equal(t, Problem{
+			Type:     "about:blank",
+			Title:    "Bad Request",
+			Status:   400,
+			Detail:   "missing name",
+			Instance: "/hello",
+		}, problem)
+	})
+
+	t.Run("plain errors become a 500 without details", func(t *testing.T) {
+		h := func(w *response.Writer, req *request.Request) {
+			_ = w.WriteError(io.ErrUnexpectedEOF)
+		}
+		resp := serve(t, h, "GET / HTTP/1.1\r\nAccept: application/problem+json\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, 500, resp.StatusCode)
+		assert.NotContains(t, string(body), "unexpected EOF")
+	})
+}
@@ -1,11 +1,18 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"runtime/debug"
 	"sync/atomic"
+	"time"
 
 	"goHttp/internal/headers"
+	"goHttp/internal/metrics"
 	"goHttp/internal/request"
 	"goHttp/internal/response"
 )
@@ -14,22 +21,93 @@ var ErrorClosingOfflineServer = fmt.Errorf("trying to close a server that is alr
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// Middleware wraps a Handler to add behavior before or after it runs
+type Middleware func(Handler) Handler
+
+// Chain wraps h in the given middleware. The first middleware listed is the
+// outermost one, so it sees the request first.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 type Server struct {
 	running  *atomic.Bool
 	listener net.Listener
 	handler  Handler
+
+	serverName     string
+	errorRenderer  ErrorRenderer
+	requestTimeout time.Duration
+	tlsConfig      *tls.Config
+	logger         *slog.Logger
+	metrics        *metrics.HTTPMetrics
+	metricsPath    string
+	// connections counts accepted connections, to number them
+	connections atomic.Uint64
+
+	// ctx is the parent of every request's context, cancelled on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Option configures optional Server behavior when passed to Serve
+type Option func(*Server)
+
+// WithServerName makes every response carry a Server header with the given
+// name, unless the handler sets one itself
+func WithServerName(name string) Option {
+	return func(s *Server) {
+		s.serverName = name
+	}
+}
+
+// WithRequestTimeout cancels a request's context once it has been
+// handled for d. Handlers that watch their context give up then.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.requestTimeout = d
+	}
+}
+
+// WithLogger sets where the server logs to. Connections and requests get
+// loggers derived from it, carrying their attributes, which handlers reach
+// through response.Writer.Logger. Without one nothing is logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithTLS serves HTTPS with the given configuration, which needs at least
+// one certificate
+func WithTLS(cfg *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+	}
 }
 
 type HandlerError struct {
 	status  response.StatusCode
 	message string
+	headers headers.Headers
 }
 
 func NewHandlerError(stat response.StatusCode, mess string) *HandlerError {
 	return &HandlerError{status: stat, message: mess}
 }
 
-func Serve(h Handler, port uint16) (*Server, error) {
+// WithErrorRenderer replaces DefaultErrorRenderer for requests that fail to
+// parse and for errors handlers pass to response.Writer.WriteError
+func WithErrorRenderer(r ErrorRenderer) Option {
+	return func(s *Server) {
+		s.errorRenderer = r
+	}
+}
+
+func Serve(h Handler, port uint16, opts ...Option) (*Server, error) {
 	// It accepts a port and starts handling requests that come in.
 	// Creates a net.Listener and returns a new Server instance. Starts listening for requests inside a goroutine.
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
@@ -40,7 +118,21 @@ func Serve(h Handler, port uint16) (*Server, error) {
 	var aBool atomic.Bool
 	aBool.Store(true)
 
-	server := Server{running: &aBool, listener: listener, handler: h}
+	server := Server{
+		running:       &aBool,
+		listener:      listener,
+		handler:       h,
+		errorRenderer: DefaultErrorRenderer,
+		logger:        slog.New(slog.DiscardHandler),
+	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(&server)
+	}
+
+	if server.tlsConfig != nil {
+		server.listener = tls.NewListener(listener, server.tlsConfig)
+	}
 
 	go server.listen()
 	return &server, nil
@@ -50,76 +142,174 @@ func (s *Server) Close() error {
 	if !s.running.Swap(false) {
 		return ErrorClosingOfflineServer
 	}
-	fmt.Println("closing server")
+	s.logger.Info("closing server", "addr", s.Addr().String())
+	// requests still in flight are told to wrap up
+	s.cancel()
 	return s.listener.Close()
 }
 
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
 func (s *Server) listen() {
 	// uses a loop to .Accept new connections as they come in, and handles each one in a new goroutine.
-	fmt.Println("starting to listen")
+	s.logger.Info("listening", "addr", s.Addr().String())
 
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
 			// shutting down via CTRL+C, so error is expected
 			if !s.running.Load() {
-				fmt.Println("listener closed, not accepting anymore connections")
+				s.logger.Debug("listener closed, no longer accepting connections")
 				return
 			}
-			fmt.Println("error accepting connection: ", err)
+			s.logger.Error("accepting connection", "err", err)
 			continue
 		}
-		// remote addr = addr of client
-		// local addr = addr of server
-		fmt.Printf("new connection accepted from %s (local address: %s)\n",
-			conn.RemoteAddr().String(),
-			conn.LocalAddr().String())
-		go s.handle(conn)
+		go s.handle(conn, s.connections.Add(1))
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
+func (s *Server) handle(conn net.Conn, id uint64) {
 	// Handles a single connection by parsing request from connection,
 	// writing a response, and then closing the connection
-	defer conn.Close()
+	hijacked := false
+	defer func() {
+		// a hijacked connection belongs to the handler now
+		if !hijacked {
+			conn.Close()
+		}
+	}()
+
+	if s.metrics != nil {
+		s.metrics.ConnectionsAccepted.Inc()
+		s.metrics.ConnectionsActive.Inc()
+		defer s.metrics.ConnectionsActive.Dec()
+	}
+
+	logger := s.logger.With("conn_id", id, "remote_addr", conn.RemoteAddr().String())
+	logger.Debug("connection accepted", "local_addr", conn.LocalAddr().String())
 
 	writer := response.NewWriter(conn)
+	writer.SetServerName(s.serverName)
+	writer.SetLogger(logger)
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	// bytes the client sent after the request, read along with it
+	var rest []byte
+	var watcher *connWatcher
+	writer.SetHijacker(func() (net.Conn, []byte, error) {
+		hijacked = true
+		if watcher != nil {
+			rest = append(rest, watcher.stop()...)
+		}
+		return conn, rest, nil
+	})
+	// runs last, once the response is finished and its size is known
+	var observe func()
+	defer func() {
+		if observe != nil {
+			observe()
+		}
+	}()
+	// the writer buffers, so whatever the handler left behind has to be
+	// finished and pushed out before the connection gets closed above
+	defer func() {
+		if err := writer.Finish(); err != nil {
+			writer.Logger().Warn("finishing response", "err", err)
+		}
+	}()
 
-	req, err := request.RequestFromReader(conn)
+	req, rest, err := request.ReadRequest(conn)
 	if err != nil {
 		// write back a minimal response when we can not parse the request
-		body := response.StatusBadBody
-		heads := response.GetDefaultHeaders(len(body))
-		err := heads.Update("Content-Type", "text/html")
-		if err != nil {
-			fmt.Printf("error replacing header: %v", err)
-			return
+		logger.Debug("malformed request", "err", err)
+		if s.metrics != nil {
+			s.metrics.ParseErrors.Inc(parseErrorLabel(err))
 		}
-
-		WriteResponse(writer, response.StatusBad, heads, body)
+		status := response.StatusBad
+		if errors.Is(err, request.ErrorBodyTooLarge) {
+			status = response.StatusRequestEntityTooLarge
+		}
+		s.errorRenderer(writer, nil, NewHandlerError(status, err.Error()))
 		return
 	}
 
-	s.handler(writer, req)
+	req.ReceivedAt = time.Now()
+	req.RemoteAddr = conn.RemoteAddr().String()
+	req.LocalAddr = conn.LocalAddr().String()
+	req.ConnID = id
+	// connections carry a single request for now
+	req.Seq = 1
+	if tc, ok := conn.(*tls.Conn); ok {
+		// reading the request completed the handshake
+		state := tc.ConnectionState()
+		req.TLS = &state
+	}
+	writer.SetLogger(logger.With("method", req.RequestLine.Method,
+		"target", req.RequestLine.RequestTarget, "seq", req.Seq))
+	// the timeout covers handling only, a slow client sending the request
+	// does not eat into it
+	if s.requestTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancelTimeout()
+	}
+	watcher = watchConn(conn, cancel)
+	defer watcher.stop()
+	if s.metrics != nil {
+		route := new(string)
+		ctx = context.WithValue(ctx, routeKey{}, route)
+		observe = func() { s.observeRequest(writer, req, *route) }
+	}
+	req = req.WithContext(ctx)
+
+	writer.SetErrorHandler(func(err error) {
+		s.errorRenderer(writer, req, asHandlerError(err))
+	})
+
+	// a HEAD response describes the body a GET would get without sending it,
+	// so handlers can treat both methods the same way
+	if req.RequestLine.Method == "HEAD" {
+		writer.OmitBody()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			writer.Logger().Error("handler panicked", "panic", r, "stack", string(debug.Stack()))
+			// too late for an error page once the handler started responding
+			if writer.Status() == 0 {
+				_ = writer.WriteError(NewHandlerError(response.StatusInServErr, ""))
+			}
+		}
+	}()
+	h := s.handler
+	if s.metrics != nil && s.metricsPath != "" && req.Path() == s.metricsPath {
+		h = s.serveMetrics
+	}
+	h(writer, req)
 }
 
 func WriteResponse(w *response.Writer, status response.StatusCode, heads headers.Headers, body string) {
 	err := w.WriteStatusLine(status)
 	if err != nil {
-		fmt.Printf("error writing status line: %v\n", err)
+		w.Logger().Error("writing status line", "err", err)
 		return
 	}
 
 	err = w.WriteHeaders(heads)
 	if err != nil {
-		fmt.Printf("error writing headers: %v\n", err)
+		w.Logger().Error("writing headers", "err", err)
 		return
 	}
 
 	if len(body) != 0 {
 		_, err := w.WriteBody([]byte(body))
 		if err != nil {
-			fmt.Printf("error writing body: %v\n", err)
+			w.Logger().Warn("writing body", "err", err)
 		}
 	}
 }
@@ -0,0 +1,387 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/metrics"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+func TestServeHijack(t *testing.T) {
+	// answers the upgrade, then echoes lines back in upper case
+	h := func(w *response.Writer, req *request.Request) {
+		_ = w.WriteStatusLine(response.StatusSwitchingProtocols)
+		_ = w.WriteHeaders(headers.Headers{"upgrade": "shout", "connection": "Upgrade"})
+		conn, buffered, err := w.Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), conn))
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			_, _ = io.WriteString(conn, strings.ToUpper(line))
+		}
+	}
+	srv, err := Serve(h, 0)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the first line goes out with the request, before any answer
+	_, err = io.WriteString(conn, "GET /shout HTTP/1.1\r\nUpgrade: shout\r\nConnection: Upgrade\r\n\r\nhello\n")
+	require.NoError(t, err)
+
+	r := bufio.NewReader(conn)
+	status, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", status)
+	for {
+		field, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if field == "\r\n" {
+			break
+		}
+	}
+
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO\n", line)
+
+	// the server left the connection open for the handler
+	_, err = io.WriteString(conn, "again\n")
+	require.NoError(t, err)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "AGAIN\n", line)
+}
+
+func TestRequestContext(t *testing.T) {
+	// handler reports why its request's context ended
+	start := func(t *testing.T, opts ...Option) (*Server, chan error) {
+		ended := make(chan error, 1)
+		h := func(w *response.Writer, req *request.Request) {
+			<-req.Context().Done()
+			ended <- req.Context().Err()
+		}
+		srv, err := Serve(h, 0, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { srv.Close() })
+		return srv, ended
+	}
+	send := func(t *testing.T, srv *Server) net.Conn {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\n\r\n")
+		require.NoError(t, err)
+		return conn
+	}
+	wait := func(t *testing.T, ended chan error) error {
+		select {
+		case err := <-ended:
+			return err
+		case <-time.After(2 * time.Second):
+			t.Fatal("request context was not cancelled")
+			return nil
+		}
+	}
+
+	t.Run("client disconnects", func(t *testing.T) {
+		srv, ended := start(t)
+		conn := send(t, srv)
+		time.Sleep(20 * time.Millisecond)
+		conn.Close()
+		assert.ErrorIs(t, wait(t, ended), context.Canceled)
+	})
+
+	t.Run("request timeout", func(t *testing.T) {
+		srv, ended := start(t, WithRequestTimeout(20*time.Millisecond))
+		send(t, srv)
+		assert.ErrorIs(t, wait(t, ended), context.DeadlineExceeded)
+	})
+
+	t.Run("request timeout starts after reading", func(t *testing.T) {
+		received := make(chan time.Time, 1)
+		h := func(w *response.Writer, req *request.Request) {
+			received <- time.Now()
+			<-req.Context().Done()
+		}
+		srv, err := Serve(h, 0, WithRequestTimeout(50*time.Millisecond))
+		require.NoError(t, err)
+		defer srv.Close()
+
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		// the request takes longer to arrive than the timeout
+		_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\n")
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+		_, err = io.WriteString(conn, "\r\n")
+		require.NoError(t, err)
+
+		start := <-received
+		_, _ = io.ReadAll(conn)
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	t.Run("server shuts down", func(t *testing.T) {
+		srv, ended := start(t)
+		send(t, srv)
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, srv.Close())
+		assert.ErrorIs(t, wait(t, ended), context.Canceled)
+	})
+
+	t.Run("middleware attaches values", func(t *testing.T) {
+		type key struct{}
+		tag := func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				next(w, req.WithContext(context.WithValue(req.Context(), key{}, "tagged")))
+			}
+		}
+		h := Chain(func(w *response.Writer, req *request.Request) {
+			body := req.Context().Value(key{}).(string)
+			WriteResponse(w, response.StatusOK, response.GetDefaultHeaders(len(body)), body)
+		}, tag)
+
+		resp := serve(t, h, "GET / HTTP/1.1\r\n\r\n")
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "tagged", string(body))
+	})
+}
+
+func TestConnectionMetadata(t *testing.T) {
+	got := make(chan *request.Request, 2)
+	h := func(w *response.Writer, req *request.Request) {
+		got <- req
+		WriteResponse(w, response.StatusOK, response.GetDefaultHeaders(0), "")
+	}
+	get := func(t *testing.T, conn net.Conn) *request.Request {
+		_, err := io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+		require.NoError(t, err)
+		_, _ = io.ReadAll(conn)
+		return <-got
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		srv, err := Serve(h, 0)
+		require.NoError(t, err)
+		defer srv.Close()
+
+		before := time.Now()
+		var ids []uint64
+		for range 2 {
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			require.NoError(t, err)
+			req := get(t, conn)
+			conn.Close()
+
+			assert.Equal(t, conn.LocalAddr().String(), req.RemoteAddr)
+			assert.Equal(t, conn.RemoteAddr().String(), req.LocalAddr)
+			assert.Nil(t, req.TLS)
+			assert.Equal(t, 1, req.Seq)
+			assert.False(t, req.ReceivedAt.Before(before))
+			ids = append(ids, req.ConnID)
+		}
+		assert.Equal(t, []uint64{1, 2}, ids)
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		// borrows the test certificate of net/http/httptest
+		ts := httptest.NewTLSServer(nil)
+		cfg := ts.TLS.Clone()
+		ts.Close()
+
+		srv, err := Serve(h, 0, WithTLS(cfg))
+		require.NoError(t, err)
+		defer srv.Close()
+
+		conn, err := tls.Dial("tcp", srv.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+		req := get(t, conn)
+
+		require.NotNil(t, req.TLS)
+		assert.True(t, req.TLS.HandshakeComplete)
+		assert.Equal(t, conn.ConnectionState().Version, req.TLS.Version)
+	})
+}
+
+func TestLogger(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		buf bytes.Buffer
+	)
+	logger := slog.New(slog.NewJSONHandler(&lockedWriter{mu: &mu, w: &buf}, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	h := func(w *response.Writer, req *request.Request) {
+		w.Logger().Info("handled")
+		panic("boom")
+	}
+	srv, err := Serve(h, 0, WithLogger(logger))
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET /logged HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	_, _ = io.ReadAll(conn)
+	conn.Close()
+	srv.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	records := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		records[rec["msg"].(string)] = rec
+	}
+
+	require.Contains(t, records, "handled")
+	handled := records["handled"]
+	assert.Equal(t, "GET", handled["method"])
+	assert.Equal(t, "/logged", handled["target"])
+	assert.Equal(t, conn.LocalAddr().String(), handled["remote_addr"])
+	assert.EqualValues(t, 1, handled["conn_id"])
+
+	require.Contains(t, records, "handler panicked")
+	assert.Equal(t, "ERROR", records["handler panicked"]["level"])
+	assert.Equal(t, "boom", records["handler panicked"]["panic"])
+	assert.Contains(t, records, "connection accepted")
+}
+
+// lockedWriter lets the connection goroutines share a buffer
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	srv, err := Serve(func(w *response.Writer, req *request.Request) {
+		t.Error("handler ran for a body over the limit")
+	}, 0)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nContent-Length: "+strconv.Itoa(request.MaxBodyBytes+1)+"\r\n\r\n")
+	require.NoError(t, err)
+	resp, _ := io.ReadAll(conn)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 413 "), string(resp))
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.NewHTTPMetrics(metrics.NewRegistry())
+	mux := NewMux()
+	mux.Handle("GET", "/items/", func(w *response.Writer, req *request.Request) {
+		WriteResponse(w, response.StatusOK, response.GetDefaultHeaders(5), "items")
+	})
+	srv, err := Serve(mux.ServeRequest, 0, WithMetrics(m, "/metrics"))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	send := func(raw string) string {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, raw)
+		require.NoError(t, err)
+		resp, _ := io.ReadAll(conn)
+		return string(resp)
+	}
+	send("GET /items/1 HTTP/1.1\r\n\r\n")
+	send("GET /items/2 HTTP/1.1\r\n\r\n")
+	send("POST /items/3 HTTP/1.1\r\nContent-Length: 2\r\n\r\nhi")
+	send("GET /nowhere HTTP/1.1\r\n\r\n")
+	send("get / HTTP/1.1\r\n\r\n")
+
+	resp := send("GET /metrics HTTP/1.1\r\n\r\n")
+	require.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"), resp)
+	assert.Contains(t, resp, "content-type: "+metrics.ContentType)
+	for _, line := range []string{
+		`gohttp_connections_accepted_total 6`,
+		// the connection asking for the metrics is still open
+		`gohttp_connections_active 1`,
+		`gohttp_requests_total{method="GET",route="/items/",status="200"} 2`,
+		`gohttp_requests_total{method="POST",route="/items/",status="405"} 1`,
+		`gohttp_requests_total{method="GET",route="",status="404"} 1`,
+		`gohttp_request_size_bytes_bucket{method="POST",route="/items/",le="64"} 1`,
+		`gohttp_response_size_bytes_sum{method="GET",route="/items/"} 10`,
+		`gohttp_request_duration_seconds_count{method="GET",route="/items/"} 2`,
+		`gohttp_parse_errors_total{error="request_line"} 1`,
+	} {
+		assert.Contains(t, resp, line+"\n")
+	}
+
+	t.Run("only read", func(t *testing.T) {
+		resp := send("DELETE /metrics HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405"), resp)
+	})
+
+	t.Run("hijacked connections", func(t *testing.T) {
+		tunnel := func(record bool) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				conn, _, err := w.Hijack()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				if record {
+					_ = w.RecordHijackedStatus(response.StatusOK)
+				}
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+				// the tunnel outlives the request by far
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+		mux.Handle("CONNECT", "/recorded", tunnel(true))
+		mux.Handle("CONNECT", "/unrecorded", tunnel(false))
+		send("CONNECT /recorded HTTP/1.1\r\n\r\n")
+		send("CONNECT /unrecorded HTTP/1.1\r\n\r\n")
+
+		resp := send("GET /metrics HTTP/1.1\r\n\r\n")
+		for _, line := range []string{
+			`gohttp_requests_total{method="CONNECT",route="/recorded",status="200"} 1`,
+			`gohttp_requests_total{method="CONNECT",route="/unrecorded",status="hijacked"} 1`,
+			`gohttp_request_duration_seconds_bucket{method="CONNECT",route="/recorded",le="0.05"} 1`,
+		} {
+			assert.Contains(t, resp, line+"\n")
+		}
+	})
+}
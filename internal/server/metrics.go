@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/metrics"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+// WithMetrics records connection, request and parse error metrics in m.
+// When path is not empty, GET requests for it are answered with the
+// metrics in the Prometheus text format instead of reaching the handler.
+func WithMetrics(m *metrics.HTTPMetrics, path string) Option {
+	return func(s *Server) {
+		s.metrics = m
+		s.metricsPath = path
+	}
+}
+
+// routeKey holds a *string in a request's context, where Mux leaves the
+// pattern that routed the request for the route label
+type routeKey struct{}
+
+func setRoute(req *request.Request, pattern string) {
+	if route, ok := req.Context().Value(routeKey{}).(*string); ok {
+		*route = pattern
+	}
+}
+
+// serveMetrics answers with everything in the server's registry
+func (s *Server) serveMetrics(w *response.Writer, req *request.Request) {
+	setRoute(req, s.metricsPath)
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+		_ = w.WriteError(NewHandlerError(response.StatusMethodNotAllowed, "").WithHeader("Allow", "GET, HEAD"))
+		return
+	}
+	metrics.Handler(s.metrics.Registry)(w, req)
+}
+
+// observeRequest records a request whose response is finished
+func (s *Server) observeRequest(w *response.Writer, req *request.Request, route string) {
+	method := req.RequestLine.Method
+	end := time.Now()
+	status := metrics.StatusLabel(w.Status())
+	switch hijacked := w.HijackedAt(); {
+	case !hijacked.IsZero():
+		// whatever the connection carries afterwards is not this request
+		end = hijacked
+		if w.Status() == 0 {
+			status = "hijacked"
+		}
+	case w.Status() == 0:
+		// nothing was written, the client got no answer at all
+		status = metrics.StatusLabel(response.StatusInServErr)
+	}
+	s.metrics.Requests.Inc(method, route, status)
+	s.metrics.RequestDuration.Observe(end.Sub(req.ReceivedAt).Seconds(), method, route)
+	s.metrics.RequestSize.Observe(float64(len(req.Body)), method, route)
+	s.metrics.ResponseSize.Observe(float64(w.BytesWritten()), method, route)
+}
+
+// parseErrorLabel sorts errors from reading a request into a few kinds,
+// which keeps the error label to a handful of values
+func parseErrorLabel(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, request.ErrorUnexectedEOF):
+		return "incomplete"
+	case errors.Is(err, request.ErrorBodyLengthLesser):
+		return "body_length"
+	case errors.Is(err, request.ErrorBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, request.ErrorInvalidNumParts), errors.Is(err, request.ErrorInvalidMethodName),
+		errors.Is(err, request.ErrorNoSlash), errors.Is(err, request.ErrorParseRequestLine):
+		return "request_line"
+	case errors.Is(err, headers.ErrorParseNoColon), errors.Is(err, headers.ErrorNoFieldName),
+		errors.Is(err, headers.ErrorSpaceBeforeColon), errors.Is(err, headers.ErrorInvalidCharInName):
+		return "header"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "other"
+}
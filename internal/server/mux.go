@@ -0,0 +1,89 @@
+package server
+
+import (
+	"slices"
+	"strings"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+// Mux routes requests to handlers by path and method. A pattern ending in "/"
+// matches every path under it, any other pattern only matches itself, and the
+// longest matching pattern wins. Requests with no matching pattern get a 404,
+// and requests whose method the pattern does not handle get a 405.
+type Mux struct {
+	// pattern -> method -> handler, where method "" takes every method
+	routes map[string]map[string]Handler
+}
+
+func NewMux() *Mux {
+	return &Mux{routes: make(map[string]map[string]Handler)}
+}
+
+// Handle registers h for method on pattern. An empty method matches every
+// method, and a GET handler answers HEAD requests too unless one is
+// registered for HEAD itself.
+func (m *Mux) Handle(method, pattern string, h Handler) {
+	methods, ok := m.routes[pattern]
+	if !ok {
+		methods = make(map[string]Handler)
+		m.routes[pattern] = methods
+	}
+	methods[method] = h
+}
+
+// Match returns the pattern that routes path, or "" if none does
+func (m *Mux) Match(path string) string {
+	if _, ok := m.routes[path]; ok {
+		return path
+	}
+
+	best := ""
+	for pattern := range m.routes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	return best
+}
+
+// ServeRequest is the Mux as a Handler, to pass to Serve or wrap in middleware
+func (m *Mux) ServeRequest(w *response.Writer, req *request.Request) {
+	pattern := m.Match(req.Path())
+	if pattern == "" {
+		_ = w.WriteError(NewHandlerError(response.StatusNotFound, "no route for "+req.Path()))
+		return
+	}
+	setRoute(req, pattern)
+
+	methods := m.routes[pattern]
+	method := req.RequestLine.Method
+	h, ok := methods[method]
+	if !ok && method == "HEAD" {
+		h, ok = methods["GET"]
+	}
+	if !ok {
+		h, ok = methods[""]
+	}
+	if !ok {
+		_ = w.WriteError(NewHandlerError(response.StatusMethodNotAllowed,
+			method+" is not allowed on "+pattern).WithHeader("Allow", allowed(methods)))
+		return
+	}
+	h(w, req)
+}
+
+func allowed(methods map[string]Handler) string {
+	var names []string
+	for method := range methods {
+		names = append(names, method)
+		if method == "GET" {
+			if _, ok := methods["HEAD"]; !ok {
+				names = append(names, "HEAD")
+			}
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
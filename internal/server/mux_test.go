@@ -0,0 +1,73 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/servetest"
+)
+
+// serve runs h the way Server.handle would and parses what it wrote back
+func serve(t *testing.T, h Handler, raw string) *http.Response {
+	t.Helper()
+	return servetest.Serve(t, h, raw, func(w *response.Writer, req *request.Request) {
+		w.SetErrorHandler(func(err error) {
+			DefaultErrorRenderer(w, req, asHandlerError(err))
+		})
+	})
+}
+
+func okHandler(body string) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		WriteResponse(w, response.StatusOK, response.GetDefaultHeaders(len(body)), body)
+	}
+}
+
+func TestMux(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("GET", "/", okHandler("root"))
+	mux.Handle("GET", "/files/", okHandler("files"))
+	mux.Handle("POST", "/files/upload", okHandler("upload"))
+	mux.Handle("", "/any", okHandler("any"))
+
+	cases := []struct {
+		raw    string
+		status int
+		body   string
+	}{
+		{"GET / HTTP/1.1\r\n\r\n", 200, "root"},
+		{"GET /files/a/b.txt?x=1 HTTP/1.1\r\n\r\n", 200, "files"},
+		{"POST /files/upload HTTP/1.1\r\n\r\n", 200, "upload"},
+		{"DELETE /any HTTP/1.1\r\n\r\n", 200, "any"},
+		{"GET http://example.com/files/x HTTP/1.1\r\n\r\n", 200, "files"},
+	}
+	for _, c := range cases {
+		resp := serve(t, mux.ServeRequest, c.raw)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, c.status, resp.StatusCode, c.raw)
+		assert.Equal(t, c.body, string(body), c.raw)
+	}
+
+	t.Run("HEAD falls back to GET", func(t *testing.T) {
+		resp := serve(t, mux.ServeRequest, "HEAD / HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mux := NewMux()
+		mux.Handle("GET", "/only", okHandler("only"))
+		resp := serve(t, mux.ServeRequest, "GET /other HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		resp := serve(t, mux.ServeRequest, "GET /files/upload HTTP/1.1\r\n\r\n")
+		assert.Equal(t, 405, resp.StatusCode)
+		assert.Equal(t, "POST", resp.Header.Get("Allow"))
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxWatchBuffer bounds what the watcher keeps of bytes a client sends
+// while its request is handled. Past that it stops reading, and with it
+// noticing disconnects.
+const maxWatchBuffer = 4096
+
+// connWatcher keeps a read pending on a connection while its request is
+// handled, so a client hanging up cancels the request's context
+type connWatcher struct {
+	conn     net.Conn
+	cancel   context.CancelFunc
+	buf      []byte
+	stopping atomic.Bool
+	exited   chan struct{}
+	once     sync.Once
+}
+
+func watchConn(conn net.Conn, cancel context.CancelFunc) *connWatcher {
+	cw := &connWatcher{conn: conn, cancel: cancel, exited: make(chan struct{})}
+	go cw.watch()
+	return cw
+}
+
+func (cw *connWatcher) watch() {
+	defer close(cw.exited)
+	chunk := make([]byte, 512)
+	for len(cw.buf) < maxWatchBuffer {
+		n, err := cw.conn.Read(chunk)
+		// whatever arrives is kept for whoever reads the connection next
+		cw.buf = append(cw.buf, chunk[:n]...)
+		if err != nil {
+			if !cw.stopping.Load() {
+				cw.cancel()
+			}
+			return
+		}
+	}
+}
+
+// stop ends the watch and returns the bytes read meanwhile. The connection
+// is readable again afterwards.
+func (cw *connWatcher) stop() []byte {
+	cw.once.Do(func() {
+		cw.stopping.Store(true)
+		// unblocks the pending read
+		_ = cw.conn.SetReadDeadline(time.Unix(1, 0))
+		<-cw.exited
+		_ = cw.conn.SetReadDeadline(time.Time{})
+	})
+	return cw.buf
+}
@@ -0,0 +1,40 @@
+// Package servetest runs handlers against raw requests in tests, without
+// a listener or a connection in between
+package servetest
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+// Serve parses raw, runs h on it the way the server would and parses what
+// it wrote back. Setup functions run first, to give the writer an error
+// handler, a logger and the like.
+func Serve(t testing.TB, h func(w *response.Writer, req *request.Request), raw string, setup ...func(w *response.Writer, req *request.Request)) *http.Response {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	var conn bytes.Buffer
+	w := response.NewWriter(&conn)
+	for _, f := range setup {
+		f(w, req)
+	}
+	if req.RequestLine.Method == "HEAD" {
+		w.OmitBody()
+	}
+	h(w, req)
+	require.NoError(t, w.Finish())
+
+	resp, err := http.ReadResponse(bufio.NewReader(&conn), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	return resp
+}
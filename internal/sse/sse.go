@@ -0,0 +1,222 @@
+package sse
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+var (
+	ErrorInvalidField = fmt.Errorf("event id and name can not contain line breaks")
+	ErrorStreamClosed = fmt.Errorf("event stream is closed")
+)
+
+// DefaultHeartbeat is how often an idle stream sends a comment, which keeps
+// proxies from timing it out and notices clients that went away
+const DefaultHeartbeat = 15 * time.Second
+
+// Event is one message of a text/event-stream
+// (https://html.spec.whatwg.org/multipage/server-sent-events.html)
+type Event struct {
+	// ID is remembered by the client and sent back in Last-Event-ID when
+	// it reconnects
+	ID string
+	// Event names the event type, the client's default is "message"
+	Event string
+	// Data may span several lines, each one is sent as a data field
+	Data string
+	// Retry, when set, tells the client how long to wait before reconnecting
+	Retry time.Duration
+}
+
+type Options struct {
+	// Heartbeat is the interval between comments sent while no events go
+	// out. Zero means DefaultHeartbeat, a negative value turns them off.
+	Heartbeat time.Duration
+	// Retry is sent to the client once when the stream opens
+	Retry time.Duration
+}
+
+// Stream writes events to a client. It is safe to use from several
+// goroutines.
+type Stream struct {
+	mu          sync.Mutex
+	w           *response.Writer
+	lastEventID string
+	done        chan struct{}
+	err         error
+	activity    chan struct{}
+}
+
+// NewStream answers req with the head of an event stream and starts the
+// heartbeat. The stream has to be closed once the handler is done with it.
+func NewStream(w *response.Writer, req *request.Request, opts Options) (*Stream, error) {
+	if opts.Heartbeat == 0 {
+		opts.Heartbeat = DefaultHeartbeat
+	}
+
+	heads := headers.NewHeaders()
+	heads.Set("Content-Type", "text/event-stream; charset=utf-8")
+	heads.Set("Cache-Control", "no-cache")
+	heads.Set("Transfer-Encoding", "chunked")
+	// reverse proxies like nginx would otherwise hold events back
+	heads.Set("X-Accel-Buffering", "no")
+	if err := w.WriteStatusLine(response.StatusOK); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return nil, err
+	}
+
+	s := &Stream{w: w, done: make(chan struct{}), activity: make(chan struct{}, 1)}
+	s.lastEventID, _ = req.Headers.Get("Last-Event-ID")
+
+	// an opening comment gets the head to the client right away
+	opening := ": stream opened\n"
+	if opts.Retry > 0 {
+		opening += "retry: " + strconv.FormatInt(opts.Retry.Milliseconds(), 10) + "\n"
+	}
+	if err := s.write(opening + "\n"); err != nil {
+		return nil, err
+	}
+
+	go s.watch(req.Context())
+	if opts.Heartbeat > 0 {
+		go s.heartbeat(opts.Heartbeat)
+	}
+	return s, nil
+}
+
+// LastEventID is the id of the last event the client saw before it
+// reconnected, empty on a first connection. Events after it should be
+// sent again.
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed when the stream ends: because it was closed, because the
+// client went away, or because the request's context ended
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes ev to the client
+func (s *Stream) Send(ev Event) error {
+	if strings.ContainsAny(ev.ID, "\r\n\x00") || strings.ContainsAny(ev.Event, "\r\n") {
+		return ErrorInvalidField
+	}
+	return s.write(formatEvent(ev))
+}
+
+// Comment sends a comment line, which clients ignore
+func (s *Stream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range splitLines(text) {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Close ends the stream and the response
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil
+	}
+	s.stop(ErrorStreamClosed)
+	_, err := s.w.WriteChunkedBodyDone()
+	return err
+}
+
+func (s *Stream) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := s.w.WriteChunkedBody([]byte(data)); err != nil {
+		// a failed write means the client is gone
+		s.stop(err)
+		return err
+	}
+
+	select {
+	case s.activity <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// stop ends the stream with err, the caller holds mu
+func (s *Stream) stop(err error) {
+	s.err = err
+	close(s.done)
+}
+
+// watch stops the stream once ctx ends, which the server does as soon as
+// the client disconnects, without waiting for a write to fail
+func (s *Stream) watch(ctx context.Context) {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.err == nil {
+			s.stop(ctx.Err())
+		}
+	}
+}
+
+// heartbeat sends a comment whenever the stream was quiet for interval
+func (s *Stream) heartbeat(interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.activity:
+			timer.Reset(interval)
+		case <-timer.C:
+			if s.write(":\n\n") != nil {
+				return
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+func formatEvent(ev Event) string {
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range splitLines(ev.Data) {
+		b.WriteString("data: " + line + "\n")
+	}
+	// a blank line dispatches the event
+	b.WriteString("\n")
+	return b.String()
+}
+
+// splitLines splits on every line ending the format knows: CRLF, CR and LF
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
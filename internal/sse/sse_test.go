@@ -0,0 +1,126 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+)
+
+// syncBuffer is a connection the heartbeat goroutine and the test can share
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// fail makes writes fail, like a client that hung up
+	fail bool
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail {
+		return 0, errors.New("broken pipe")
+	}
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newStream(t *testing.T, raw string, opts Options) (*Stream, *syncBuffer) {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	conn := &syncBuffer{}
+	s, err := NewStream(response.NewWriter(conn), req, opts)
+	require.NoError(t, err)
+	return s, conn
+}
+
+func TestFormatEvent(t *testing.T) {
+	cases := map[string]Event{
+		"data: hi\n\n": {Data: "hi"},
+		"id: 7\nevent: update\nretry: 1500\ndata: a\ndata: b\ndata: c\n\n": {
+			ID: "7", Event: "update", Retry: 1500 * time.Millisecond, Data: "a\r\nb\rc",
+		},
+		"data: \n\n": {},
+	}
+	for want, ev := range cases {
+		assert.Equal(t, want, formatEvent(ev))
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Run("head and events", func(t *testing.T) {
+		s, conn := newStream(t, "GET /events HTTP/1.1\r\nLast-Event-ID: 41\r\n\r\n",
+			Options{Heartbeat: -1, Retry: 2 * time.Second})
+		assert.Equal(t, "41", s.LastEventID())
+
+		require.NoError(t, s.Send(Event{ID: "42", Data: "hello"}))
+		assert.ErrorIs(t, s.Send(Event{ID: "4\n2"}), ErrorInvalidField)
+		require.NoError(t, s.Close())
+
+		out := conn.String()
+		assert.Contains(t, out, "content-type: text/event-stream; charset=utf-8\r\n")
+		assert.Contains(t, out, "cache-control: no-cache\r\n")
+		assert.Contains(t, out, "retry: 2000\n")
+		assert.Contains(t, out, "id: 42\ndata: hello\n\n")
+		assert.True(t, strings.HasSuffix(out, "0\r\n\r\n"))
+
+		<-s.Done()
+		assert.ErrorIs(t, s.Send(Event{Data: "late"}), ErrorStreamClosed)
+	})
+
+	t.Run("heartbeats", func(t *testing.T) {
+		s, conn := newStream(t, "GET /events HTTP/1.1\r\n\r\n", Options{Heartbeat: 10 * time.Millisecond})
+		defer s.Close()
+
+		assert.Eventually(t, func() bool {
+			return strings.Count(conn.String(), ":\n\n") >= 2
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("stops when the client is gone", func(t *testing.T) {
+		s, conn := newStream(t, "GET /events HTTP/1.1\r\n\r\n", Options{Heartbeat: 10 * time.Millisecond})
+		conn.mu.Lock()
+		conn.fail = true
+		conn.mu.Unlock()
+
+		// the heartbeat notices without the handler sending anything
+		select {
+		case <-s.Done():
+		case <-time.After(time.Second):
+			t.Fatal("stream did not notice the client went away")
+		}
+		assert.Error(t, s.Send(Event{Data: "anyone?"}))
+	})
+
+	t.Run("stops when the request ends", func(t *testing.T) {
+		req, err := request.RequestFromReader(strings.NewReader("GET /events HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(req.Context())
+		s, err := NewStream(response.NewWriter(&syncBuffer{}), req.WithContext(ctx), Options{Heartbeat: -1})
+		require.NoError(t, err)
+
+		// nothing is written, the server cancels the context on disconnect
+		cancel()
+		select {
+		case <-s.Done():
+		case <-time.After(time.Second):
+			t.Fatal("stream did not notice the request ended")
+		}
+		assert.ErrorIs(t, s.Send(Event{Data: "anyone?"}), context.Canceled)
+	})
+}
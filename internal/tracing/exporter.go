@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span as handed to an Exporter
+type SpanData struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Kind       SpanKind       `json:"kind"`
+	Service    string         `json:"service,omitempty"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	DurationMS float64        `json:"duration_ms"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	TraceState string         `json:"trace_state,omitempty"`
+	// Status is "ok" or "error", with Error saying what went wrong
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Exporter sends finished spans somewhere. Export is called from the
+// goroutine that ended the span, so it has to be safe for concurrent use.
+type Exporter interface {
+	Export(span SpanData) error
+}
+
+// JSONExporter writes every span as a line of JSON, which needs nothing
+// but a file to collect traces
+type JSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONExporter writes spans to w, e.g. an *os.File or a
+// middleware.RotatingFile
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+func (e *JSONExporter) Export(span SpanData) error {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
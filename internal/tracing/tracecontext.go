@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"goHttp/internal/headers"
+)
+
+var (
+	ErrorInvalidTraceparent = fmt.Errorf("invalid traceparent")
+	ErrorInvalidTracestate  = fmt.Errorf("invalid tracestate")
+)
+
+// flagSampled is the only trace flag defined so far
+const flagSampled = 0x01
+
+// maxTracestateMembers is how many list members tracestate may carry
+const maxTracestateMembers = 32
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries, in
+// the traceparent and tracestate headers of W3C Trace Context
+// (https://www.w3.org/TR/trace-context/)
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// State is the vendor specific tracestate list, passed on unchanged
+	State string
+}
+
+// IsValid reports whether sc identifies a span, a zero SpanContext does not
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Sampled reports whether the caller records the trace
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// Traceparent formats sc as a version 00 traceparent value
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses a traceparent value. Versions after 00 are read
+// the way version 00 is laid out, as the spec asks of parsers that do not
+// know them.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	// version, trace id, parent id and flags take 55 characters
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') {
+		return sc, ErrorInvalidTraceparent
+	}
+	parts := strings.Split(value[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrorInvalidTraceparent
+	}
+
+	version, ok := decodeHex(parts[0])
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return sc, ErrorInvalidTraceparent
+	}
+	traceID, ok := decodeHex(parts[1])
+	if !ok {
+		return sc, ErrorInvalidTraceparent
+	}
+	spanID, ok := decodeHex(parts[2])
+	if !ok {
+		return sc, ErrorInvalidTraceparent
+	}
+	flags, ok := decodeHex(parts[3])
+	if !ok {
+		return sc, ErrorInvalidTraceparent
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrorInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex only accepts lowercase hex, as traceparent requires
+func decodeHex(s string) ([]byte, bool) {
+	if strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// ParseTracestate checks a tracestate value and returns it with empty
+// members dropped. The value is kept as a whole or not at all.
+func ParseTracestate(value string) (string, error) {
+	var members []string
+	seen := map[string]bool{}
+	for _, member := range strings.Split(value, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(member, "=")
+		if !ok || !validStateKey(key) || !validStateValue(val) || seen[key] {
+			return "", ErrorInvalidTracestate
+		}
+		seen[key] = true
+		members = append(members, member)
+	}
+	if len(members) > maxTracestateMembers {
+		return "", ErrorInvalidTracestate
+	}
+	return strings.Join(members, ","), nil
+}
+
+// validStateKey accepts simple keys and tenant@system multi-tenant keys
+func validStateKey(key string) bool {
+	if key == "" || len(key) > 256 {
+		return false
+	}
+	if key[0] < 'a' || key[0] > 'z' {
+		if key[0] < '0' || key[0] > '9' || !strings.Contains(key, "@") {
+			return false
+		}
+	}
+	for _, c := range []byte(key) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '_', c == '-', c == '*', c == '/', c == '@':
+		default:
+			return false
+		}
+	}
+	return strings.Count(key, "@") <= 1
+}
+
+func validStateValue(val string) bool {
+	if val == "" || len(val) > 256 || val[len(val)-1] == ' ' {
+		return false
+	}
+	for _, c := range []byte(val) {
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract reads the span context a caller sent in h. It returns a zero
+// SpanContext when there is no valid traceparent, and drops a tracestate
+// that does not parse.
+func Extract(h headers.Headers) SpanContext {
+	parent, err := h.Get("traceparent")
+	if err != nil {
+		return SpanContext{}
+	}
+	// a repeated traceparent got joined into one value and is invalid
+	sc, err := ParseTraceparent(parent)
+	if err != nil {
+		return SpanContext{}
+	}
+	if state, err := h.Get("tracestate"); err == nil {
+		sc.State, _ = ParseTracestate(state)
+	}
+	return sc
+}
+
+// Inject writes sc into h, replacing whatever trace context h carried
+func Inject(h headers.Headers, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	h["traceparent"] = sc.Traceparent()
+	if sc.State != "" {
+		h["tracestate"] = sc.State
+	} else {
+		delete(h, "tracestate")
+	}
+}
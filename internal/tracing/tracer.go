@@ -0,0 +1,169 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+type SpanKind string
+
+const (
+	// KindServer spans cover a request the server handles
+	KindServer SpanKind = "server"
+	// KindClient spans cover a request sent to another server
+	KindClient SpanKind = "client"
+	// KindInternal spans cover work that stays inside the process
+	KindInternal SpanKind = "internal"
+)
+
+// Tracer starts spans and hands the finished ones to its exporter
+type Tracer struct {
+	service  string
+	exporter Exporter
+	logger   *slog.Logger
+}
+
+// NewTracer returns a tracer that names service in every span it
+// exports to exp
+func NewTracer(service string, exp Exporter) *Tracer {
+	return &Tracer{service: service, exporter: exp, logger: slog.New(slog.DiscardHandler)}
+}
+
+// SetLogger sets where failed exports are reported, nowhere by default
+func (t *Tracer) SetLogger(l *slog.Logger) {
+	t.logger = l
+}
+
+// Span is one timed operation in a trace. Its methods do nothing on a nil
+// Span, so code can trace unconditionally whether or not a tracer is set up.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	kind     SpanKind
+	sc       SpanContext
+	parentID SpanID
+	start    time.Time
+
+	mu         sync.Mutex
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span in ctx, nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a span. It continues the trace of remote when that is
+// valid, of the span in ctx otherwise, and starts a new, sampled trace
+// when there is neither. The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	parent := remote
+	if !parent.IsValid() {
+		if s := SpanFromContext(ctx); s != nil {
+			parent = s.sc
+		}
+	}
+
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attributes: map[string]any{}}
+	if parent.IsValid() {
+		s.sc = parent
+		s.parentID = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Flags = flagSampled
+	}
+	rand.Read(s.sc.SpanID[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+// StartChild begins a span below the one in ctx, with the same tracer.
+// Without a span in ctx it returns ctx and a nil Span.
+func StartChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind, SpanContext{})
+}
+
+// Context returns what to send along to continue the trace elsewhere
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// End finishes the span and exports it if the trace is sampled. Only the
+// first call does anything.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:    s.sc.TraceID.String(),
+		SpanID:     s.sc.SpanID.String(),
+		Name:       s.name,
+		Kind:       s.kind,
+		Service:    s.tracer.service,
+		Start:      s.start,
+		End:        time.Now(),
+		Attributes: maps.Clone(s.attributes),
+		TraceState: s.sc.State,
+		Status:     "ok",
+	}
+	if s.parentID.IsValid() {
+		data.ParentID = s.parentID.String()
+	}
+	if s.err != nil {
+		data.Status, data.Error = "error", s.err.Error()
+	}
+	data.DurationMS = float64(data.End.Sub(data.Start)) / float64(time.Millisecond)
+	s.mu.Unlock()
+
+	if !s.sc.Sampled() {
+		return
+	}
+	if err := s.tracer.exporter.Export(data); err != nil {
+		s.tracer.logger.Warn("exporting span", "span", s.name, "trace_id", data.TraceID, "err", err)
+	}
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/headers"
+)
+
+// the example from the W3C Trace Context spec
+const (
+	exampleParent  = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	exampleTraceID = "0af7651916cd43dd8448eb211c80319c"
+)
+
+// recorder keeps exported spans in memory
+type recorder struct {
+	spans []SpanData
+}
+
+func (r *recorder) Export(span SpanData) error {
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(exampleParent)
+	require.NoError(t, err)
+	assert.Equal(t, exampleTraceID, sc.TraceID.String())
+	assert.Equal(t, "b7ad6b7169203331", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.Equal(t, exampleParent, sc.Traceparent())
+
+	t.Run("future version", func(t *testing.T) {
+		sc, err := ParseTraceparent("cc-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-09-extra")
+		require.NoError(t, err)
+		assert.True(t, sc.Sampled())
+	})
+
+	invalid := map[string]string{
+		"empty":            "",
+		"uppercase":        "00-0AF7651916CD43DD8448EB211C80319C-B7AD6B7169203331-01",
+		"zero trace id":    "00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"zero parent id":   "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"version ff":       "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00 with more":     exampleParent + "-extra",
+		"short trace id":   "00-0af7651916cd43dd8448eb211c8031-b7ad6b7169203331-01",
+		"not hex":          "00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+		"joined duplicate": exampleParent + ", " + exampleParent,
+	}
+	for name, value := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseTraceparent(value)
+			assert.ErrorIs(t, err, ErrorInvalidTraceparent)
+		})
+	}
+}
+
+func TestParseTracestate(t *testing.T) {
+	state, err := ParseTracestate("rojo=00f067aa0ba902b7, ,congo=t61rcWkgMzE,fw529a3039@dt=abc")
+	require.NoError(t, err)
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE,fw529a3039@dt=abc", state)
+
+	for _, value := range []string{"Rojo=1", "rojo", "rojo=1,rojo=2", "rojo=a=b"} {
+		_, err := ParseTracestate(value)
+		assert.ErrorIs(t, err, ErrorInvalidTracestate, value)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	in := headers.Headers{"traceparent": exampleParent, "tracestate": "rojo=00f067aa0ba902b7"}
+	remote := Extract(in)
+	require.True(t, remote.IsValid())
+
+	rec := &recorder{}
+	tracer := NewTracer("test", rec)
+	ctx, server := tracer.Start(context.Background(), "GET /", KindServer, remote)
+	_, client := StartChild(ctx, "GET", KindClient)
+
+	out := headers.Headers{"traceparent": "stale", "tracestate": "stale=1"}
+	Inject(out, client.Context())
+	sent := Extract(out)
+	assert.Equal(t, exampleTraceID, sent.TraceID.String())
+	assert.Equal(t, client.Context().SpanID, sent.SpanID)
+	assert.Equal(t, "rojo=00f067aa0ba902b7", out["tracestate"])
+
+	client.SetAttribute("http.response.status_code", 200)
+	client.End()
+	client.End()
+	server.End()
+	require.Len(t, rec.spans, 2)
+	assert.Equal(t, server.Context().SpanID.String(), rec.spans[0].ParentID)
+	assert.Equal(t, "b7ad6b7169203331", rec.spans[1].ParentID)
+	assert.Equal(t, "test", rec.spans[1].Service)
+	assert.Equal(t, "ok", rec.spans[0].Status)
+
+	t.Run("new trace", func(t *testing.T) {
+		_, root := tracer.Start(context.Background(), "root", KindInternal, Extract(headers.Headers{}))
+		assert.True(t, root.Context().IsValid())
+		assert.True(t, root.Context().Sampled())
+		root.End()
+		assert.Empty(t, rec.spans[2].ParentID)
+	})
+
+	t.Run("unsampled", func(t *testing.T) {
+		remote, _ := ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+		_, span := tracer.Start(context.Background(), "quiet", KindServer, remote)
+		span.End()
+		assert.Len(t, rec.spans, 3)
+	})
+
+	t.Run("no span", func(t *testing.T) {
+		ctx, span := StartChild(context.Background(), "orphan", KindClient)
+		assert.Nil(t, span)
+		assert.Nil(t, SpanFromContext(ctx))
+		// all no-ops
+		span.SetAttribute("k", "v")
+		span.End()
+	})
+}
+
+func TestJSONExporter(t *testing.T) {
+	var out bytes.Buffer
+	tracer := NewTracer("test", NewJSONExporter(&out))
+	_, span := tracer.Start(context.Background(), "work", KindInternal, SpanContext{})
+	span.SetError(context.Canceled)
+	span.End()
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, "work", got["name"])
+	assert.Equal(t, "internal", got["kind"])
+	assert.Equal(t, "error", got["status"])
+	assert.Equal(t, "context canceled", got["error"])
+	assert.Len(t, got["trace_id"], 32)
+	assert.Equal(t, byte('\n'), out.Bytes()[out.Len()-1])
+}
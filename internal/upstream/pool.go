@@ -0,0 +1,326 @@
+package upstream
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goHttp/internal/client"
+)
+
+type Strategy int
+
+const (
+	// RoundRobin hands requests to healthy backends in turn
+	RoundRobin Strategy = iota
+	// LeastConnections picks the healthy backend with the fewest requests in flight
+	LeastConnections
+	// ConsistentHash sends every request with the same key to the same
+	// backend for as long as that backend stays healthy
+	ConsistentHash
+)
+
+// replicas is how many points each backend gets on the hash ring,
+// enough to spread keys evenly over a handful of backends
+const replicas = 100
+
+var (
+	ErrorNoBackends        = fmt.Errorf("upstream pool needs at least one backend")
+	ErrorNoHealthyBackends = fmt.Errorf("no healthy backend available")
+)
+
+type PoolOptions struct {
+	Strategy Strategy
+	// HashHeader names the request header consistent hashing keys on.
+	// Empty means the client IP is used instead.
+	HashHeader string
+
+	// HealthPath is requested on every backend each HealthInterval, and
+	// a backend counts as healthy while it answers with a 2xx or 3xx.
+	// Active health checks are off when HealthPath is empty.
+	HealthPath     string
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+
+	// MaxFails is how many requests in a row may fail before a backend
+	// gets ejected. Zero turns passive ejection off.
+	MaxFails int
+	// EjectFor is how long an ejected backend sits out when there are no
+	// active health checks to bring it back
+	EjectFor time.Duration
+}
+
+// Backend is one server in a Pool
+type Backend struct {
+	URL *url.URL
+
+	healthy  atomic.Bool
+	active   atomic.Int64
+	failures atomic.Int64
+	// unix nanoseconds after which a passively ejected backend is let back in
+	ejectedUntil atomic.Int64
+}
+
+// Healthy reports whether the backend currently takes requests
+func (b *Backend) Healthy() bool {
+	if b.healthy.Load() {
+		return true
+	}
+	until := b.ejectedUntil.Load()
+	return until != 0 && time.Now().UnixNano() >= until
+}
+
+// Active returns how many requests the backend is handling right now
+func (b *Backend) Active() int64 {
+	return b.active.Load()
+}
+
+// Pool balances requests over a set of backends, keeping an eye on their
+// health through active checks and through how their requests turn out
+type Pool struct {
+	backends []*Backend
+	opts     PoolOptions
+	next     atomic.Uint64
+
+	// hash ring for ConsistentHash, sorted by point
+	ring []ringPoint
+
+	client *client.Client
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type ringPoint struct {
+	hash    uint32
+	backend *Backend
+}
+
+// NewPool returns a pool over the given backend URLs. Every backend starts
+// out healthy. When opts has a HealthPath, health checks run until Close.
+func NewPool(urls []string, opts PoolOptions) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, ErrorNoBackends
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = 10 * time.Second
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = 2 * time.Second
+	}
+	if opts.EjectFor <= 0 {
+		opts.EjectFor = 30 * time.Second
+	}
+
+	p := &Pool{
+		opts:   opts,
+		client: &client.Client{Timeout: opts.HealthTimeout},
+		stop:   make(chan struct{}),
+	}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("backend needs a scheme and a host: %s", raw)
+		}
+		b := &Backend{URL: u}
+		b.healthy.Store(true)
+		p.backends = append(p.backends, b)
+
+		for i := range replicas {
+			p.ring = append(p.ring, ringPoint{hash: hashKey(u.String() + "#" + strconv.Itoa(i)), backend: b})
+		}
+	}
+	slices.SortFunc(p.ring, func(a, b ringPoint) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+
+	if opts.HealthPath != "" {
+		p.wg.Add(1)
+		go p.healthLoop()
+	}
+	return p, nil
+}
+
+// Backends returns every backend in the pool, healthy or not
+func (p *Pool) Backends() []*Backend {
+	return p.backends
+}
+
+// HashHeader is the header to take the consistent hashing key from,
+// empty when the client IP should be used
+func (p *Pool) HashHeader() string {
+	return p.opts.HashHeader
+}
+
+// Pick chooses the backend for a request and counts it as in flight, so
+// every successful Pick has to be followed by a Done. key is only used by
+// ConsistentHash.
+func (p *Pool) Pick(key string) (*Backend, error) {
+	var b *Backend
+	switch p.opts.Strategy {
+	case LeastConnections:
+		b = p.leastConnections()
+	case ConsistentHash:
+		b = p.consistentHash(key)
+	default:
+		b = p.roundRobin()
+	}
+	if b == nil {
+		return nil, ErrorNoHealthyBackends
+	}
+	b.active.Add(1)
+	return b, nil
+}
+
+// Done reports how a request picked with Pick went. Failed means the
+// backend could not be reached or answered with a server error.
+func (p *Pool) Done(b *Backend, failed bool) {
+	b.active.Add(-1)
+	if !failed {
+		b.failures.Store(0)
+		// a backend let back in after its ejection proved itself
+		if !b.healthy.Load() && b.Healthy() {
+			p.markHealthy(b)
+		}
+		return
+	}
+
+	if p.opts.MaxFails > 0 && b.failures.Add(1) >= int64(p.opts.MaxFails) {
+		p.eject(b)
+	}
+}
+
+// Close stops the health checks
+func (p *Pool) Close() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	p.wg.Wait()
+}
+
+func (p *Pool) roundRobin() *Backend {
+	n := uint64(len(p.backends))
+	start := p.next.Add(1) - 1
+	for i := range n {
+		if b := p.backends[(start+i)%n]; b.Healthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *Pool) leastConnections() *Backend {
+	var best *Backend
+	// start the scan at a rotating offset so ties do not all go to the first backend
+	n := len(p.backends)
+	start := int(p.next.Add(1) - 1)
+	for i := range n {
+		b := p.backends[(start+i)%n]
+		if b.Healthy() && (best == nil || b.Active() < best.Active()) {
+			best = b
+		}
+	}
+	return best
+}
+
+func (p *Pool) consistentHash(key string) *Backend {
+	h := hashKey(key)
+	idx, _ := slices.BinarySearchFunc(p.ring, h, func(point ringPoint, target uint32) int {
+		return cmp.Compare(point.hash, target)
+	})
+
+	// walk clockwise past unhealthy backends, so only the keys of a backend
+	// that went down move elsewhere
+	for i := range len(p.ring) {
+		if b := p.ring[(idx+i)%len(p.ring)].backend; b.Healthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *Pool) eject(b *Backend) {
+	b.healthy.Store(false)
+	if p.opts.HealthPath == "" {
+		// nothing will check on it, so let it back in after a while
+		b.ejectedUntil.Store(time.Now().Add(p.opts.EjectFor).UnixNano())
+	}
+}
+
+func (p *Pool) markHealthy(b *Backend) {
+	b.failures.Store(0)
+	b.ejectedUntil.Store(0)
+	b.healthy.Store(true)
+}
+
+func (p *Pool) healthLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.opts.HealthInterval)
+	defer ticker.Stop()
+
+	p.checkAll()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.checkAll()
+		}
+	}
+}
+
+func (p *Pool) checkAll() {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.check(b) {
+				p.markHealthy(b)
+			} else {
+				b.healthy.Store(false)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(b *Backend) bool {
+	target := *b.URL
+	target.Path = p.opts.HealthPath
+	target.RawQuery = ""
+
+	resp, err := p.client.Get(context.Background(), target.String())
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	// FNV on its own leaves keys that only differ in their last byte, like
+	// the ring points of one backend, bunched up. The murmur3 finalizer
+	// spreads them over the whole ring.
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
@@ -0,0 +1,159 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var backendURLs = []string{"http://a.internal", "http://b.internal", "http://c.internal"}
+
+func pick(t *testing.T, p *Pool, key string) string {
+	t.Helper()
+	b, err := p.Pick(key)
+	require.NoError(t, err)
+	p.Done(b, false)
+	return b.URL.Host
+}
+
+func TestRoundRobin(t *testing.T) {
+	p, err := NewPool(backendURLs, PoolOptions{})
+	require.NoError(t, err)
+	defer p.Close()
+
+	var got []string
+	for range 6 {
+		got = append(got, pick(t, p, ""))
+	}
+	assert.Equal(t, []string{"a.internal", "b.internal", "c.internal", "a.internal", "b.internal", "c.internal"}, got)
+}
+
+func TestLeastConnections(t *testing.T) {
+	p, err := NewPool(backendURLs, PoolOptions{Strategy: LeastConnections})
+	require.NoError(t, err)
+	defer p.Close()
+
+	// ties are spread out, so every backend gets one request
+	var picked []*Backend
+	for range 3 {
+		b, err := p.Pick("")
+		require.NoError(t, err)
+		picked = append(picked, b)
+	}
+	for _, b := range p.Backends() {
+		assert.Equal(t, int64(1), b.Active())
+	}
+
+	// the one that finishes first gets the next request
+	p.Done(picked[1], false)
+	b, err := p.Pick("")
+	require.NoError(t, err)
+	assert.Equal(t, picked[1], b)
+}
+
+func TestConsistentHash(t *testing.T) {
+	p, err := NewPool(backendURLs, PoolOptions{Strategy: ConsistentHash, MaxFails: 1})
+	require.NoError(t, err)
+	defer p.Close()
+
+	first := pick(t, p, "user-42")
+	for range 10 {
+		assert.Equal(t, first, pick(t, p, "user-42"))
+	}
+
+	// keys spread over more than one backend
+	seen := map[string]bool{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		seen[pick(t, p, key)] = true
+	}
+	assert.Greater(t, len(seen), 1)
+
+	// when the backend goes away, its keys move somewhere else
+	for _, b := range p.Backends() {
+		if b.URL.Host == first {
+			picked, _ := p.Pick("user-42")
+			require.Equal(t, b, picked)
+			p.Done(b, true)
+		}
+	}
+	moved := pick(t, p, "user-42")
+	assert.NotEqual(t, first, moved)
+}
+
+func TestPassiveEjection(t *testing.T) {
+	p, err := NewPool(backendURLs[:2], PoolOptions{MaxFails: 2, EjectFor: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer p.Close()
+	a := p.Backends()[0]
+
+	// one failure is not enough
+	p.Done(pickBackend(t, p, a), true)
+	assert.True(t, a.Healthy())
+
+	p.Done(pickBackend(t, p, a), true)
+	assert.False(t, a.Healthy())
+	for range 4 {
+		assert.Equal(t, "b.internal", pick(t, p, ""))
+	}
+
+	// back after the ejection runs out, and fully healthy after a success
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, a.Healthy())
+	p.Done(pickBackend(t, p, a), false)
+	assert.True(t, a.healthy.Load())
+
+	// every backend down
+	for _, b := range p.Backends() {
+		p.eject(b)
+		b.ejectedUntil.Store(0)
+	}
+	_, err = p.Pick("")
+	assert.ErrorIs(t, err, ErrorNoHealthyBackends)
+}
+
+// pickBackend picks until want comes up, to steer round robin in tests
+func pickBackend(t *testing.T, p *Pool, want *Backend) *Backend {
+	t.Helper()
+	for range 10 {
+		b, err := p.Pick("")
+		require.NoError(t, err)
+		if b == want {
+			return b
+		}
+		p.Done(b, false)
+	}
+	t.Fatalf("never picked %s", want.URL)
+	return nil
+}
+
+func TestActiveHealthChecks(t *testing.T) {
+	var up atomic.Bool
+	up.Store(false)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	steady := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer steady.Close()
+
+	p, err := NewPool([]string{flaky.URL, steady.URL}, PoolOptions{
+		HealthPath:     "/healthz",
+		HealthInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer p.Close()
+	flakyBackend := p.Backends()[0]
+
+	assert.Eventually(t, func() bool { return !flakyBackend.Healthy() }, time.Second, 5*time.Millisecond)
+
+	// reinstated once the health check passes again
+	up.Store(true)
+	assert.Eventually(t, flakyBackend.Healthy, time.Second, 5*time.Millisecond)
+}
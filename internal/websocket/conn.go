@@ -0,0 +1,427 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrorMessageTooLarge = fmt.Errorf("websocket message exceeds the size limit")
+	ErrorProtocol        = fmt.Errorf("websocket protocol violation")
+	ErrorInvalidUTF8     = fmt.Errorf("text message is not valid UTF-8")
+	ErrorClosed          = fmt.Errorf("websocket connection is closed")
+	ErrorControlTooLarge = fmt.Errorf("control frame payload is longer than 125 bytes")
+	ErrorMessageType     = fmt.Errorf("not a data message type")
+)
+
+// Close codes (RFC 6455 section 7.4.1)
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// closeTimeout is how long Close waits for the peer to answer a close frame
+const closeTimeout = 5 * time.Second
+
+// fragmentSize is the payload size of the fragments NextWriter sends
+const fragmentSize = 4096
+
+// CloseError is what ReadMessage returns once the peer closed the connection
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return "websocket closed with code " + strconv.Itoa(e.Code)
+	}
+	return "websocket closed with code " + strconv.Itoa(e.Code) + ": " + e.Text
+}
+
+// Conn is the server end of a websocket connection. One goroutine may read
+// while others write; writes are safe to call concurrently.
+type Conn struct {
+	// Subprotocol is the one agreed on in the handshake, if any
+	Subprotocol string
+
+	conn       net.Conn
+	br         *bufio.Reader
+	maxMessage int64
+	compress   bool
+	inflater   inflater
+	readErr    error
+	reading    atomic.Bool
+	onPong     func(payload []byte)
+
+	// dataMu keeps data messages from interleaving, writeMu frames
+	dataMu    sync.Mutex
+	writeMu   sync.Mutex
+	deflater  deflater
+	closeSent bool
+	closeOnce sync.Once
+}
+
+func newConn(conn net.Conn, buffered []byte, maxMessage int64) *Conn {
+	return &Conn{
+		conn:       conn,
+		br:         bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), conn)),
+		maxMessage: maxMessage,
+	}
+}
+
+// SetPongHandler sets a function called with the payload of every pong
+// received, to tell whether a peer is still there after a ping
+func (c *Conn) SetPongHandler(f func(payload []byte)) {
+	c.onPong = f
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next text or binary message, put together from
+// its fragments. Pings are answered along the way. Once the peer closes
+// the connection a *CloseError is returned. Any error leaves the
+// connection closed, and every later call returns the same error.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	c.reading.Store(true)
+	defer c.reading.Store(false)
+
+	typ, p, err := c.readMessage()
+	if err != nil {
+		c.readErr = err
+		c.closeConn()
+		return 0, nil, err
+	}
+	return typ, p, nil
+}
+
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var (
+		typ        MessageType
+		compressed bool
+		message    []byte
+	)
+	for {
+		h, err := readFrameHeader(c.br)
+		if err != nil {
+			if errors.Is(err, ErrorFrameTooLarge) {
+				return 0, nil, c.fail(CloseMessageTooBig, ErrorMessageTooLarge)
+			}
+			return 0, nil, err
+		}
+		if h.rsv23 || (h.rsv1 && (!c.compress || h.opcode != TextMessage && h.opcode != BinaryMessage)) {
+			return 0, nil, c.fail(CloseProtocolError, fmt.Errorf("%w: reserved bits set", ErrorProtocol))
+		}
+		// clients have to mask every frame (section 5.1)
+		if !h.masked {
+			return 0, nil, c.fail(CloseProtocolError, ErrorUnmaskedFrame)
+		}
+
+		if h.opcode.isControl() {
+			if !h.fin || h.length > maxControlPayload {
+				return 0, nil, c.fail(CloseProtocolError, fmt.Errorf("%w: fragmented or oversized control frame", ErrorProtocol))
+			}
+			payload, err := c.readPayload(h)
+			if err != nil {
+				return 0, nil, err
+			}
+			if err := c.handleControl(h.opcode, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+
+		switch h.opcode {
+		case continuationFrame:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, fmt.Errorf("%w: continuation frame without a message", ErrorProtocol))
+			}
+		case TextMessage, BinaryMessage:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, fmt.Errorf("%w: new message before the last one ended", ErrorProtocol))
+			}
+			typ, compressed = h.opcode, h.rsv1
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Errorf("%w: unknown opcode %d", ErrorProtocol, h.opcode))
+		}
+
+		// checked before reading, so a huge length can not make us allocate
+		if int64(len(message))+h.length > c.maxMessage {
+			return 0, nil, c.fail(CloseMessageTooBig, ErrorMessageTooLarge)
+		}
+		payload, err := c.readPayload(h)
+		if err != nil {
+			return 0, nil, err
+		}
+		message = append(message, payload...)
+		if !h.fin {
+			continue
+		}
+
+		if compressed {
+			message, err = c.inflater.decompress(message, c.maxMessage)
+			if errors.Is(err, ErrorMessageTooLarge) {
+				return 0, nil, c.fail(CloseMessageTooBig, err)
+			}
+			if err != nil {
+				return 0, nil, c.fail(CloseInvalidPayload, err)
+			}
+		}
+		if typ == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidPayload, ErrorInvalidUTF8)
+		}
+		return typ, message, nil
+	}
+}
+
+func (c *Conn) readPayload(h frameHeader) ([]byte, error) {
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return nil, err
+	}
+	maskBytes(h.mask, 0, payload)
+	return payload, nil
+}
+
+func (c *Conn) handleControl(typ MessageType, payload []byte) error {
+	switch typ {
+	case PingMessage:
+		err := c.WriteControl(PongMessage, payload)
+		if errors.Is(err, ErrorClosed) {
+			// no more pongs once we sent a close frame ourselves
+			return nil
+		}
+		return err
+	case PongMessage:
+		if c.onPong != nil {
+			c.onPong(payload)
+		}
+		return nil
+	default:
+		return c.handleClose(payload)
+	}
+}
+
+// handleClose answers the peer's close frame with one of our own, unless
+// we started the closing handshake, and reports the close
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, fmt.Errorf("%w: close frame with a one byte payload", ErrorProtocol))
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(CloseProtocolError, fmt.Errorf("%w: invalid close code %d", ErrorProtocol, closeErr.Code))
+		}
+		if !utf8.ValidString(closeErr.Text) {
+			return c.fail(CloseInvalidPayload, ErrorInvalidUTF8)
+		}
+	}
+
+	// echoing the code is the usual way to acknowledge the close
+	answer := payload
+	if len(answer) > 2 {
+		answer = answer[:2]
+	}
+	if err := c.WriteControl(CloseMessage, answer); err != nil && !errors.Is(err, ErrorClosed) {
+		return err
+	}
+	return closeErr
+}
+
+// validCloseCode reports whether code may be sent in a close frame
+// (section 7.4)
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail closes the connection with code after a protocol error, and
+// returns err for the reader
+func (c *Conn) fail(code int, err error) error {
+	_ = c.writeClose(code, err.Error())
+	return err
+}
+
+// WriteMessage sends data as a single text or binary message
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return ErrorMessageType
+	}
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.compress {
+		compressed, err := c.deflater.compress(data)
+		if err != nil {
+			return err
+		}
+		return c.writeFrame(true, true, typ, compressed)
+	}
+	return c.writeFrame(true, false, typ, data)
+}
+
+// NextWriter returns a writer for a message of unknown length, sent in
+// fragments as it is written and ended by Close. Other data messages wait
+// until it is closed. Fragmented messages are sent uncompressed.
+func (c *Conn) NextWriter(typ MessageType) (io.WriteCloser, error) {
+	if typ != TextMessage && typ != BinaryMessage {
+		return nil, ErrorMessageType
+	}
+	c.dataMu.Lock()
+	return &messageWriter{c: c, opcode: typ}, nil
+}
+
+type messageWriter struct {
+	c      *Conn
+	opcode MessageType
+	buf    []byte
+	closed bool
+}
+
+func (mw *messageWriter) Write(p []byte) (int, error) {
+	if mw.closed {
+		return 0, ErrorClosed
+	}
+	mw.buf = append(mw.buf, p...)
+	for len(mw.buf) > fragmentSize {
+		if err := mw.send(false, mw.buf[:fragmentSize]); err != nil {
+			return 0, err
+		}
+		mw.buf = mw.buf[fragmentSize:]
+	}
+	return len(p), nil
+}
+
+func (mw *messageWriter) send(fin bool, payload []byte) error {
+	mw.c.writeMu.Lock()
+	defer mw.c.writeMu.Unlock()
+	err := mw.c.writeFrame(fin, false, mw.opcode, payload)
+	// everything after the first fragment continues the message
+	mw.opcode = continuationFrame
+	return err
+}
+
+func (mw *messageWriter) Close() error {
+	if mw.closed {
+		return nil
+	}
+	mw.closed = true
+	defer mw.c.dataMu.Unlock()
+	return mw.send(true, mw.buf)
+}
+
+// WriteControl sends a ping, pong or close frame. Control frames may be
+// sent in between the fragments of a message.
+func (c *Conn) WriteControl(typ MessageType, payload []byte) error {
+	if !typ.isControl() {
+		return ErrorMessageType
+	}
+	if len(payload) > maxControlPayload {
+		return ErrorControlTooLarge
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrame(true, false, typ, payload)
+}
+
+// writeFrame sends one frame, the caller holds writeMu
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode MessageType, payload []byte) error {
+	if c.closeSent {
+		return ErrorClosed
+	}
+	header := appendFrameHeader(make([]byte, 0, 10), fin, rsv1, opcode, len(payload))
+	// header and payload in one write
+	bufs := net.Buffers{header, payload}
+	if _, err := bufs.WriteTo(c.conn); err != nil {
+		return err
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+	return nil
+}
+
+func (c *Conn) writeClose(code int, text string) error {
+	var payload []byte
+	if code != 0 {
+		// the reason is cut to fit a control frame
+		if len(text) > maxControlPayload-2 {
+			text = strings.ToValidUTF8(text[:maxControlPayload-2], "")
+		}
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, text...)
+	}
+	return c.WriteControl(CloseMessage, payload)
+}
+
+// Close starts the closing handshake with code and text, waits a moment
+// for the peer to answer, and closes the connection. When another
+// goroutine is in ReadMessage, that one gets to see the answer.
+func (c *Conn) Close(code int, text string) error {
+	if err := c.writeClose(code, text); err != nil && !errors.Is(err, ErrorClosed) {
+		c.closeConn()
+		return err
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(closeTimeout)); err != nil {
+		c.closeConn()
+		return nil
+	}
+	if c.reading.Load() {
+		return nil
+	}
+	// nobody else is reading, so wait for the answer here
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return nil
+		}
+	}
+}
+
+func (c *Conn) closeConn() {
+	c.closeOnce.Do(func() {
+		_ = c.conn.Close()
+	})
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+)
+
+// deflateTail ends a compressed message: the empty stored block that
+// senders strip off (RFC 7692 section 7.2.1), followed by a final empty
+// block so the flate reader sees a complete stream
+const deflateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+// deflateWindow is how far back a flate stream may refer
+const deflateWindow = 32 << 10
+
+// negotiateDeflate picks the first permessage-deflate offer out of a
+// Sec-WebSocket-Extensions value we can work with, and returns the
+// answer to it. The server always compresses every message on its own,
+// which saves keeping a compressor around between messages.
+func negotiateDeflate(extensions string) (string, bool) {
+	for _, offer := range strings.Split(extensions, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+
+		answer := "permessage-deflate; server_no_context_takeover"
+		usable := true
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch strings.TrimSpace(name) {
+			case "server_no_context_takeover":
+			case "client_no_context_takeover":
+				answer += "; client_no_context_takeover"
+			case "server_max_window_bits":
+				// a smaller window than flate's 32KB can not be promised
+				usable = strings.Trim(strings.TrimSpace(value), `"`) == "15"
+			case "client_max_window_bits":
+				// our reader copes with any window, so the client keeps its own
+			default:
+				usable = false
+			}
+		}
+		if usable {
+			return answer, true
+		}
+	}
+	return "", false
+}
+
+// deflater compresses whole messages
+type deflater struct {
+	buf bytes.Buffer
+	fw  *flate.Writer
+}
+
+func (d *deflater) compress(p []byte) ([]byte, error) {
+	d.buf.Reset()
+	if d.fw == nil {
+		d.fw, _ = flate.NewWriter(&d.buf, flate.DefaultCompression)
+	} else {
+		d.fw.Reset(&d.buf)
+	}
+	if _, err := d.fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := d.fw.Flush(); err != nil {
+		return nil, err
+	}
+	// Flush ends in an empty stored block the receiver adds back itself
+	return bytes.TrimSuffix(d.buf.Bytes(), []byte(deflateTail[:4])), nil
+}
+
+// inflater decompresses messages. A client may refer back to earlier
+// messages, so the end of what it sent so far is kept as the dictionary
+// for the next one.
+type inflater struct {
+	window []byte
+}
+
+// decompress inflates p, failing with ErrorMessageTooLarge once the
+// result grows past limit
+func (i *inflater) decompress(p []byte, limit int64) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(p), strings.NewReader(deflateTail))
+	fr := flate.NewReaderDict(src, i.window)
+	defer fr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(fr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, ErrorMessageTooLarge
+	}
+
+	i.window = append(i.window, out...)
+	if len(i.window) > deflateWindow {
+		i.window = append([]byte(nil), i.window[len(i.window)-deflateWindow:]...)
+	}
+	return out, nil
+}
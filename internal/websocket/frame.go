@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MessageType is the opcode of a frame (RFC 6455 section 5.2)
+type MessageType byte
+
+const (
+	continuationFrame MessageType = 0
+	TextMessage       MessageType = 1
+	BinaryMessage     MessageType = 2
+	CloseMessage      MessageType = 8
+	PingMessage       MessageType = 9
+	PongMessage       MessageType = 10
+)
+
+func (t MessageType) isControl() bool {
+	return t >= CloseMessage
+}
+
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+	maskBit = 0x80
+
+	// control frames carry at most this much (section 5.5)
+	maxControlPayload = 125
+)
+
+var (
+	ErrorUnmaskedFrame = fmt.Errorf("client frame is not masked")
+	ErrorFrameTooLarge = fmt.Errorf("frame length is out of range")
+)
+
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	rsv23  bool
+	opcode MessageType
+	masked bool
+	mask   [4]byte
+	length int64
+}
+
+// readFrameHeader reads the header of the next frame off r
+func readFrameHeader(r io.Reader) (frameHeader, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return frameHeader{}, err
+	}
+
+	h := frameHeader{
+		fin:    buf[0]&finBit != 0,
+		rsv1:   buf[0]&rsv1Bit != 0,
+		rsv23:  buf[0]&(rsv2Bit|rsv3Bit) != 0,
+		opcode: MessageType(buf[0] & 0x0f),
+		masked: buf[1]&maskBit != 0,
+		length: int64(buf[1] & 0x7f),
+	}
+
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(r, buf[:2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(buf[:2]))
+	case 127:
+		if _, err := io.ReadFull(r, buf[:8]); err != nil {
+			return h, err
+		}
+		n := binary.BigEndian.Uint64(buf[:8])
+		// the most significant bit has to be zero
+		if n > 1<<63-1 {
+			return h, ErrorFrameTooLarge
+		}
+		h.length = int64(n)
+	}
+
+	if h.masked {
+		if _, err := io.ReadFull(r, h.mask[:]); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// appendFrameHeader appends the header of an unmasked frame, as servers send them
+func appendFrameHeader(b []byte, fin, rsv1 bool, opcode MessageType, length int) []byte {
+	first := byte(opcode)
+	if fin {
+		first |= finBit
+	}
+	if rsv1 {
+		first |= rsv1Bit
+	}
+	b = append(b, first)
+
+	switch {
+	case length <= 125:
+		b = append(b, byte(length))
+	case length <= 0xffff:
+		b = append(b, 126)
+		b = binary.BigEndian.AppendUint16(b, uint16(length))
+	default:
+		b = append(b, 127)
+		b = binary.BigEndian.AppendUint64(b, uint64(length))
+	}
+	return b
+}
+
+// maskBytes applies the masking key to p in place, pos being the offset of
+// p in the frame's payload. Masking and unmasking are the same operation.
+func maskBytes(mask [4]byte, pos int, p []byte) int {
+	for i := range p {
+		p[i] ^= mask[(pos+i)&3]
+	}
+	return (pos + len(p)) & 3
+}
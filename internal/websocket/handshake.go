@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"goHttp/internal/headers"
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+var (
+	ErrorNotWebSocket   = fmt.Errorf("request is not a websocket upgrade")
+	ErrorBadHandshake   = fmt.Errorf("invalid websocket handshake")
+	ErrorVersion        = fmt.Errorf("unsupported websocket version")
+	ErrorOriginRejected = fmt.Errorf("websocket origin not allowed")
+)
+
+// acceptGUID is appended to the client's key to prove the server
+// understood the handshake (RFC 6455 section 1.3)
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DefaultMaxMessageSize is the largest message a Conn accepts unless
+// Options says otherwise
+const DefaultMaxMessageSize = 1 << 20
+
+type Options struct {
+	// Subprotocols the server speaks, most preferred first. The first one
+	// the client also offers is picked.
+	Subprotocols []string
+	// MaxMessageSize limits messages read, after decompression and across
+	// fragments. Zero means DefaultMaxMessageSize.
+	MaxMessageSize int64
+	// Compression accepts the permessage-deflate extension (RFC 7692)
+	// when the client offers it
+	Compression bool
+	// CheckOrigin decides whether a browser on the request's Origin may
+	// connect. By default the Origin has to be missing or match Host.
+	CheckOrigin func(req *request.Request) bool
+}
+
+// IsUpgrade reports whether req asks to switch to the websocket protocol
+func IsUpgrade(req *request.Request) bool {
+	upgrade, _ := req.Headers.Get("Upgrade")
+	connection, _ := req.Headers.Get("Connection")
+	return hasToken(upgrade, "websocket") && hasToken(connection, "upgrade")
+}
+
+// Upgrade performs the server side of the opening handshake and takes over
+// the connection. When the handshake fails, an error response has already
+// been written and the returned error says why.
+func Upgrade(w *response.Writer, req *request.Request, opts Options) (*Conn, error) {
+	if opts.MaxMessageSize == 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if opts.CheckOrigin == nil {
+		opts.CheckOrigin = sameOrigin
+	}
+
+	heads, compress, err := handshake(req, opts)
+	if err != nil {
+		_ = w.WriteError(handshakeError(err))
+		return nil, err
+	}
+
+	if err := w.WriteStatusLine(response.StatusSwitchingProtocols); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(heads); err != nil {
+		return nil, err
+	}
+	conn, buffered, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConn(conn, buffered, opts.MaxMessageSize)
+	c.Subprotocol, _ = heads.Get("Sec-WebSocket-Protocol")
+	c.compress = compress
+	return c, nil
+}
+
+// handshake checks the client's opening handshake and returns the headers
+// of the server's answer, and whether messages are compressed
+func handshake(req *request.Request, opts Options) (headers.Headers, bool, error) {
+	if req.RequestLine.Method != "GET" || !IsUpgrade(req) {
+		return nil, false, ErrorNotWebSocket
+	}
+	if version, _ := req.Headers.Get("Sec-WebSocket-Version"); strings.TrimSpace(version) != "13" {
+		return nil, false, ErrorVersion
+	}
+	key, _ := req.Headers.Get("Sec-WebSocket-Key")
+	key = strings.TrimSpace(key)
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, false, fmt.Errorf("%w: Sec-WebSocket-Key has to be 16 random bytes in base64", ErrorBadHandshake)
+	}
+	if !opts.CheckOrigin(req) {
+		return nil, false, ErrorOriginRejected
+	}
+
+	heads := headers.NewHeaders()
+	heads.Set("Upgrade", "websocket")
+	heads.Set("Connection", "Upgrade")
+	heads.Set("Sec-WebSocket-Accept", acceptKey(key))
+
+	offered, _ := req.Headers.Get("Sec-WebSocket-Protocol")
+	if protocol := pickSubprotocol(offered, opts.Subprotocols); protocol != "" {
+		heads.Set("Sec-WebSocket-Protocol", protocol)
+	}
+
+	compress := false
+	if opts.Compression {
+		extensions, _ := req.Headers.Get("Sec-WebSocket-Extensions")
+		if answer, ok := negotiateDeflate(extensions); ok {
+			heads.Set("Sec-WebSocket-Extensions", answer)
+			compress = true
+		}
+	}
+	return heads, compress, nil
+}
+
+func handshakeError(err error) *server.HandlerError {
+	switch err {
+	case ErrorVersion:
+		// tells the client which version to retry with (section 4.4)
+		return server.NewHandlerError(response.StatusUpgradeRequired, err.Error()).
+			WithHeader("Sec-WebSocket-Version", "13")
+	case ErrorOriginRejected:
+		return server.NewHandlerError(response.StatusForbidden, err.Error())
+	default:
+		return server.NewHandlerError(response.StatusBad, err.Error())
+	}
+}
+
+// acceptKey computes Sec-WebSocket-Accept for a Sec-WebSocket-Key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func pickSubprotocol(offered string, supported []string) string {
+	var client []string
+	for _, p := range strings.Split(offered, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			client = append(client, p)
+		}
+	}
+	for _, p := range supported {
+		if slices.Contains(client, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// sameOrigin lets clients without an Origin header, which are not
+// browsers, and pages served from the same host connect
+func sameOrigin(req *request.Request) bool {
+	origin, _ := req.Headers.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host, _ := req.Headers.Get("Host")
+	return strings.EqualFold(u.Host, host)
+}
+
+// hasToken reports whether the comma separated list contains token,
+// ignoring case
+func hasToken(list, token string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,307 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"goHttp/internal/request"
+	"goHttp/internal/response"
+	"goHttp/internal/server"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// testClient speaks just enough of the client side to drive a Conn
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startEcho runs a server that upgrades every request and echoes messages
+// back until the client closes
+func startEcho(t *testing.T, opts Options) string {
+	h := func(w *response.Writer, req *request.Request) {
+		c, err := Upgrade(w, req, opts)
+		if err != nil {
+			return
+		}
+		for {
+			typ, p, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(typ, p); err != nil {
+				return
+			}
+		}
+	}
+	srv, err := server.Serve(h, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return srv.Addr().String()
+}
+
+// dial performs the handshake with the extra header lines and returns the
+// client along with the status line and fields of the answer
+func dial(t *testing.T, addr string, extra string) (*testClient, string, map[string]string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: "+addr+"\r\n"+
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: "+testKey+"\r\n"+extra+"\r\n")
+	require.NoError(t, err)
+
+	r := bufio.NewReader(conn)
+	status, err := r.ReadString('\n')
+	require.NoError(t, err)
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		key, val, _ := strings.Cut(strings.TrimSpace(line), ": ")
+		fields[strings.ToLower(key)] = val
+	}
+	return &testClient{t: t, conn: conn, r: r}, strings.TrimSpace(status), fields
+}
+
+func (c *testClient) send(first byte, payload []byte, masked bool) {
+	c.t.Helper()
+	frame := []byte{first}
+	second := byte(0)
+	if masked {
+		second = maskBit
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, second|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, second|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, second|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	body := append([]byte(nil), payload...)
+	if masked {
+		mask := [4]byte{1, 2, 3, 4}
+		frame = append(frame, mask[:]...)
+		maskBytes(mask, 0, body)
+	}
+	_, err := c.conn.Write(append(frame, body...))
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) sendFrame(fin bool, opcode MessageType, payload string) {
+	first := byte(opcode)
+	if fin {
+		first |= finBit
+	}
+	c.send(first, []byte(payload), true)
+}
+
+func (c *testClient) read() (frameHeader, []byte) {
+	c.t.Helper()
+	h, err := readFrameHeader(c.r)
+	require.NoError(c.t, err)
+	assert.False(c.t, h.masked, "servers do not mask")
+	payload := make([]byte, h.length)
+	_, err = io.ReadFull(c.r, payload)
+	require.NoError(c.t, err)
+	return h, payload
+}
+
+// expectClose reads frames up to a close frame and returns its code
+func (c *testClient) expectClose() int {
+	c.t.Helper()
+	for {
+		h, payload := c.read()
+		if h.opcode == CloseMessage {
+			if len(payload) < 2 {
+				return CloseNoStatus
+			}
+			return int(binary.BigEndian.Uint16(payload))
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	addr := startEcho(t, Options{Subprotocols: []string{"chat.v2", "chat"}})
+
+	t.Run("accepted", func(t *testing.T) {
+		_, status, fields := dial(t, addr, "Sec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: chat, chat.v2\r\n")
+		assert.Equal(t, "HTTP/1.1 101 Switching Protocols", status)
+		// the example from RFC 6455 section 1.3
+		assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", fields["sec-websocket-accept"])
+		assert.Equal(t, "websocket", fields["upgrade"])
+		assert.Equal(t, "chat.v2", fields["sec-websocket-protocol"])
+		assert.Empty(t, fields["sec-websocket-extensions"])
+	})
+
+	t.Run("wrong version", func(t *testing.T) {
+		_, status, fields := dial(t, addr, "Sec-WebSocket-Version: 8\r\n")
+		assert.Equal(t, "HTTP/1.1 426 Upgrade Required", status)
+		assert.Equal(t, "13", fields["sec-websocket-version"])
+	})
+
+	t.Run("foreign origin", func(t *testing.T) {
+		_, status, _ := dial(t, addr, "Sec-WebSocket-Version: 13\r\nOrigin: https://evil.example\r\n")
+		assert.Equal(t, "HTTP/1.1 403 Forbidden", status)
+	})
+
+	t.Run("extension offers", func(t *testing.T) {
+		cases := map[string]string{
+			"permessage-deflate":                                                "permessage-deflate; server_no_context_takeover",
+			"permessage-deflate; client_max_window_bits":                        "permessage-deflate; server_no_context_takeover",
+			"permessage-deflate; client_no_context_takeover":                    "permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+			"permessage-deflate; server_max_window_bits=10, permessage-deflate": "permessage-deflate; server_no_context_takeover",
+			"x-webkit-deflate-frame":                                            "",
+		}
+		for offer, want := range cases {
+			got, _ := negotiateDeflate(offer)
+			assert.Equal(t, want, got, offer)
+		}
+	})
+}
+
+func TestMessages(t *testing.T) {
+	addr := startEcho(t, Options{MaxMessageSize: 1 << 16})
+	open := func(t *testing.T) *testClient {
+		c, status, _ := dial(t, addr, "Sec-WebSocket-Version: 13\r\n")
+		require.Equal(t, "HTTP/1.1 101 Switching Protocols", status)
+		return c
+	}
+
+	t.Run("echo", func(t *testing.T) {
+		c := open(t)
+		c.sendFrame(true, TextMessage, "hello")
+		h, p := c.read()
+		assert.Equal(t, TextMessage, h.opcode)
+		assert.True(t, h.fin)
+		assert.Equal(t, "hello", string(p))
+
+		big := bytes.Repeat([]byte{7}, 70000-10000)
+		c.send(finBit|byte(BinaryMessage), big, true)
+		h, p = c.read()
+		assert.Equal(t, BinaryMessage, h.opcode)
+		assert.Equal(t, big, p)
+	})
+
+	t.Run("fragments with a ping in between", func(t *testing.T) {
+		c := open(t)
+		c.sendFrame(false, TextMessage, "frag")
+		c.sendFrame(true, PingMessage, "are you there")
+		c.sendFrame(false, continuationFrame, "men")
+		c.sendFrame(true, continuationFrame, "ted")
+
+		h, p := c.read()
+		assert.Equal(t, PongMessage, h.opcode)
+		assert.Equal(t, "are you there", string(p))
+		h, p = c.read()
+		assert.Equal(t, TextMessage, h.opcode)
+		assert.Equal(t, "fragmented", string(p))
+	})
+
+	t.Run("close handshake", func(t *testing.T) {
+		c := open(t)
+		c.send(finBit|byte(CloseMessage), binary.BigEndian.AppendUint16(nil, CloseGoingAway), true)
+		assert.Equal(t, CloseGoingAway, c.expectClose())
+		// and the server hangs up
+		_, err := c.r.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	violations := map[string]struct {
+		send func(c *testClient)
+		code int
+	}{
+		"unmasked frame":     {func(c *testClient) { c.send(finBit|byte(TextMessage), []byte("hi"), false) }, CloseProtocolError},
+		"reserved bits":      {func(c *testClient) { c.send(finBit|rsv2Bit|byte(TextMessage), []byte("hi"), true) }, CloseProtocolError},
+		"stray continuation": {func(c *testClient) { c.sendFrame(true, continuationFrame, "x") }, CloseProtocolError},
+		"fragmented ping":    {func(c *testClient) { c.sendFrame(false, PingMessage, "x") }, CloseProtocolError},
+		"invalid utf-8":      {func(c *testClient) { c.sendFrame(true, TextMessage, "\xff\xfe") }, CloseInvalidPayload},
+		"too large": {func(c *testClient) {
+			c.send(finBit|byte(BinaryMessage), make([]byte, 1<<16+1), true)
+		}, CloseMessageTooBig},
+		"too large across fragments": {func(c *testClient) {
+			c.send(byte(BinaryMessage), make([]byte, 1<<15), true)
+			c.send(finBit, make([]byte, 1<<15+1), true)
+		}, CloseMessageTooBig},
+		"invalid close code": {func(c *testClient) {
+			c.send(finBit|byte(CloseMessage), binary.BigEndian.AppendUint16(nil, 1005), true)
+		}, CloseProtocolError},
+	}
+	for name, v := range violations {
+		t.Run(name, func(t *testing.T) {
+			c := open(t)
+			v.send(c)
+			assert.Equal(t, v.code, c.expectClose())
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	addr := startEcho(t, Options{Compression: true})
+	c, _, fields := dial(t, addr, "Sec-WebSocket-Version: 13\r\nSec-WebSocket-Extensions: permessage-deflate\r\n")
+	require.Equal(t, "permessage-deflate; server_no_context_takeover", fields["sec-websocket-extensions"])
+
+	// the client keeps its context, so the second message refers back
+	// into the first
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	for _, msg := range []string{"repeat after me, repeat after me", "repeat after me"} {
+		buf.Reset()
+		_, _ = fw.Write([]byte(msg))
+		require.NoError(t, fw.Flush())
+		c.send(finBit|rsv1Bit|byte(TextMessage), bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff}), true)
+
+		h, p := c.read()
+		require.True(t, h.rsv1)
+		plain, err := io.ReadAll(flate.NewReader(io.MultiReader(bytes.NewReader(p), strings.NewReader(deflateTail))))
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(plain))
+	}
+}
+
+func TestNextWriter(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := newConn(server, nil, DefaultMaxMessageSize)
+
+	msg := bytes.Repeat([]byte("abcdefgh"), 1500)
+	go func() {
+		w, _ := c.NextWriter(BinaryMessage)
+		_, _ = w.Write(msg[:5000])
+		_, _ = w.Write(msg[5000:])
+		_ = w.Close()
+	}()
+
+	tc := &testClient{t: t, conn: client, r: bufio.NewReader(client)}
+	var got []byte
+	opcodes := []MessageType{}
+	for {
+		h, p := tc.read()
+		opcodes = append(opcodes, h.opcode)
+		got = append(got, p...)
+		if h.fin {
+			break
+		}
+	}
+	assert.Equal(t, []MessageType{BinaryMessage, continuationFrame, continuationFrame}, opcodes)
+	assert.Equal(t, msg, got)
+}